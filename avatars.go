@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Сколько хранить загруженную фотографию профиля
+const avatarTTL = time.Hour
+
+// Минимальная ширина фотографии профиля, подходящей для аватара
+const avatarMinWidth = 128
+
+// Максимальный размер фотографии профиля
+const avatarMaxSize = 1 << 20
+
+// Сколько фотографий профиля хранить в кэше
+const avatarCacheLimit = 1000
+
+// Структура для загруженной фотографии профиля
+type avatar struct {
+	data        []byte // nil, если у пользователя нет фотографии
+	contentType string
+	fetched     time.Time
+}
+
+// AvatarServer раздаёт фотографии профилей Telegram по HTTP. Ссылки на файлы
+// Telegram содержат токен бота, поэтому Discord получает аватары через этот сервер.
+// Ссылки подписаны, чтобы сервер не загружал фотографии произвольных пользователей
+type AvatarServer struct {
+	bot       *tgbotapi.BotAPI
+	publicURL string
+	key       []byte // ключ подписи ссылок
+
+	mu    sync.Mutex
+	cache map[int64]*avatar
+}
+
+// Создание сервера аватаров. publicURL адрес, по которому сервер доступен извне
+func NewAvatarServer(bot *tgbotapi.BotAPI, publicURL string) *AvatarServer {
+	// Ключ получается из токена, чтобы ссылки оставались верными после перезапуска
+	key := sha256.Sum256([]byte("avatars:" + bot.Token))
+	return &AvatarServer{
+		bot:       bot,
+		publicURL: strings.TrimRight(publicURL, "/"),
+		key:       key[:],
+		cache:     make(map[int64]*avatar),
+	}
+}
+
+// URL подписанная ссылка на аватар пользователя Telegram
+func (a *AvatarServer) URL(userID string) string {
+	return a.publicURL + "/avatars/" + userID + "/" + a.sign(userID)
+}
+
+// sign подпись ID пользователя для ссылки на аватар
+func (a *AvatarServer) sign(userID string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(userID))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// ServeHTTP отдаёт фотографию профиля по пути /avatars/<ID пользователя>/<подпись>
+func (a *AvatarServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, signature, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/avatars/"), "/")
+	if !hmac.Equal([]byte(signature), []byte(a.sign(id))) {
+		http.NotFound(w, r)
+		return
+	}
+	userID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	photo := a.get(userID)
+	if photo.data == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", photo.contentType)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(avatarTTL.Seconds())))
+	w.Write(photo.data)
+}
+
+// get возвращает фотографию профиля из кэша или загружает её из Telegram
+func (a *AvatarServer) get(userID int64) *avatar {
+	a.mu.Lock()
+	photo, exists := a.cache[userID]
+	a.mu.Unlock()
+	if exists && time.Since(photo.fetched) < avatarTTL {
+		return photo
+	}
+
+	photo, err := a.fetch(userID)
+	if err != nil {
+		log.Printf("Failed to fetch avatar of Telegram user %d: %v", userID, err)
+		// Ошибку тоже кэшируем, чтобы не запрашивать Telegram на каждое сообщение
+		photo = &avatar{fetched: time.Now()}
+	}
+
+	a.mu.Lock()
+	a.cache[userID] = photo
+	a.evict()
+	a.mu.Unlock()
+	return photo
+}
+
+// evict удаляет из кэша устаревшие фотографии, а если их всё ещё больше
+// avatarCacheLimit, то и самые старые. Вызывается под a.mu
+func (a *AvatarServer) evict() {
+	if len(a.cache) <= avatarCacheLimit {
+		return
+	}
+	for userID, photo := range a.cache {
+		if time.Since(photo.fetched) >= avatarTTL {
+			delete(a.cache, userID)
+		}
+	}
+	for len(a.cache) > avatarCacheLimit {
+		var oldest int64
+		var oldestTime time.Time
+		for userID, photo := range a.cache {
+			if oldestTime.IsZero() || photo.fetched.Before(oldestTime) {
+				oldest, oldestTime = userID, photo.fetched
+			}
+		}
+		delete(a.cache, oldest)
+	}
+}
+
+// fetch загружает фотографию профиля через getUserProfilePhotos
+func (a *AvatarServer) fetch(userID int64) (*avatar, error) {
+	photos, err := a.bot.GetUserProfilePhotos(tgbotapi.UserProfilePhotosConfig{UserID: userID, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if photos.TotalCount == 0 || len(photos.Photos) == 0 || len(photos.Photos[0]) == 0 {
+		return &avatar{fetched: time.Now()}, nil
+	}
+
+	// Размеры отсортированы по возрастанию, берём наименьший подходящий
+	sizes := photos.Photos[0]
+	size := sizes[len(sizes)-1]
+	for _, candidate := range sizes {
+		if candidate.Width >= avatarMinWidth {
+			size = candidate
+			break
+		}
+	}
+
+	url, err := a.bot.GetFileDirectURL(size.FileID)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, avatarMaxSize))
+	if err != nil {
+		return nil, err
+	}
+	return &avatar{data: data, contentType: http.DetectContentType(data), fetched: time.Now()}, nil
+}
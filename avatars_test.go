@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestAvatarServerRejectsUnsignedURLs(t *testing.T) {
+	server := NewAvatarServer(&tgbotapi.BotAPI{Token: "token"}, "https://bridge.example/")
+	url := server.URL("42")
+	if !strings.HasPrefix(url, "https://bridge.example/avatars/42/") {
+		t.Fatalf("unexpected avatar URL %q", url)
+	}
+	signature := strings.TrimPrefix(url, "https://bridge.example/avatars/42/")
+
+	for _, path := range []string{
+		"/avatars/42",
+		"/avatars/43/" + signature,
+		"/avatars/42/" + strings.Repeat("0", len(signature)),
+	} {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d, want %d", path, recorder.Code, http.StatusNotFound)
+		}
+	}
+	if len(server.cache) != 0 {
+		t.Errorf("rejected requests should not fetch avatars, cache has %d entries", len(server.cache))
+	}
+}
+
+func TestAvatarServerCacheLimit(t *testing.T) {
+	server := NewAvatarServer(&tgbotapi.BotAPI{Token: "token"}, "https://bridge.example")
+	now := time.Now()
+	server.cache[1] = &avatar{fetched: now.Add(-2 * avatarTTL)}
+	server.cache[2] = &avatar{fetched: now.Add(-time.Minute)}
+	for id := int64(3); id <= avatarCacheLimit+2; id++ {
+		server.cache[id] = &avatar{fetched: now}
+	}
+
+	server.evict()
+	if len(server.cache) != avatarCacheLimit {
+		t.Errorf("cache has %d entries, want %d", len(server.cache), avatarCacheLimit)
+	}
+	if server.cache[1] != nil || server.cache[2] != nil {
+		t.Error("expired and oldest avatars should be evicted first")
+	}
+}
@@ -0,0 +1,724 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Текст, которым помечаются копии удалённых сообщений
+const deletedText = "[deleted]"
+
+// Сколько хранить профиль связанного аккаунта
+const profileTTL = time.Hour
+
+// Структура для профиля связанного аккаунта в кэше
+type cachedProfile struct {
+	sender  *Sender // nil, если профиль получить не удалось
+	fetched time.Time
+}
+
+// Структура для моста между каналами Discord и чатами Telegram
+type Bridge struct {
+	discord    Platform
+	telegram   Platform
+	routes     *Routes
+	store      *MessageStore
+	identities *Identities
+	threads    *Threads
+	queue      *DeliveryQueue
+	filters    *Filters
+
+	profilesMu sync.Mutex
+	profiles   map[string]*cachedProfile // профили связанных аккаунтов по платформе и ID
+
+	failedThreadsMu sync.Mutex
+	failedThreads   map[string]bool // ветки, которые не удалось создать, по маршруту и ID исходной ветки
+}
+
+// Создание моста между двумя платформами по таблице маршрутизации
+func NewBridge(discord, telegram Platform, routes *Routes, store *MessageStore, identities *Identities, threads *Threads, queue *DeliveryQueue, filters *Filters) *Bridge {
+	return &Bridge{
+		discord:       discord,
+		telegram:      telegram,
+		routes:        routes,
+		store:         store,
+		identities:    identities,
+		threads:       threads,
+		queue:         queue,
+		filters:       filters,
+		profiles:      make(map[string]*cachedProfile),
+		failedThreads: make(map[string]bool),
+	}
+}
+
+// Run пересылает входящие сообщения обеих платформ, пока их каналы открыты.
+// Отправка выполняется через очередь доставки
+func (b *Bridge) Run() {
+	b.queue.Start(b.deliver)
+
+	discordMessages := b.discord.Messages()
+	telegramMessages := b.telegram.Messages()
+
+	for discordMessages != nil || telegramMessages != nil {
+		select {
+		case msg, ok := <-discordMessages:
+			if !ok {
+				discordMessages = nil
+				continue
+			}
+			b.fromDiscord(msg)
+		case msg, ok := <-telegramMessages:
+			if !ok {
+				telegramMessages = nil
+				continue
+			}
+			b.fromTelegram(msg)
+		}
+	}
+}
+
+// fromDiscord ставит в очередь пересылку сообщения из Discord во все связанные чаты Telegram
+func (b *Bridge) fromDiscord(msg *Message) {
+	if msg = b.filters.Apply(msg); msg == nil {
+		return
+	}
+	msg = b.withMentions(msg, b.telegram)
+	msg = b.withProfile(msg, b.telegram)
+	for _, route := range b.routes.FromDiscord(msg.ChatID) {
+		b.queue.Push(&DeliveryJob{
+			Target:           PlatformTelegram,
+			DiscordChannelID: route.DiscordChannelID,
+			TelegramChatID:   route.TelegramChatID,
+			Message:          msg,
+		})
+	}
+}
+
+// fromTelegram ставит в очередь пересылку сообщения из Telegram во все связанные каналы Discord
+func (b *Bridge) fromTelegram(msg *Message) {
+	if msg = b.filters.Apply(msg); msg == nil {
+		return
+	}
+	msg = b.withMentions(msg, b.discord)
+	msg = b.withProfile(msg, b.discord)
+	for _, route := range b.routes.FromTelegram(msg.ChatID) {
+		b.queue.Push(&DeliveryJob{
+			Target:           PlatformDiscord,
+			DiscordChannelID: route.DiscordChannelID,
+			TelegramChatID:   route.TelegramChatID,
+			Message:          msg,
+		})
+	}
+}
+
+// deliver выполняет задачу доставки. Возвращённая ошибка означает, что
+// ничего не было отправлено и задачу можно повторить
+func (b *Bridge) deliver(job *DeliveryJob) error {
+	route := b.routes.Find(job.DiscordChannelID, job.TelegramChatID)
+	if route == nil {
+		log.Printf("Dropping delivery job %d: route %s <-> %d no longer exists", job.ID, job.DiscordChannelID, job.TelegramChatID)
+		return nil
+	}
+
+	msg := job.Message
+	target, chatID := b.telegram, route.TelegramChat()
+	if job.Target == PlatformDiscord {
+		target, chatID = b.discord, route.DiscordChannelID
+	}
+
+	switch msg.Kind {
+	case MessageCreated:
+		if target == b.discord {
+			return b.toDiscord(route, msg)
+		}
+		return b.toTelegram(route, msg)
+	case MessageEdited:
+		thread := b.thread(route, msg, false)
+		if target == b.discord {
+			opts, quote := b.reply(msg, b.discord, chatID, thread)
+			if route.Format.Webhook && opts.ReplyTo != "" {
+				quote = msg.ReplyTo
+			}
+			texts := discordTexts(route, msg, quote)
+			return b.editCopy(b.discord, chatID, msg, texts, texts[0])
+		}
+		_, quote := b.reply(msg, b.telegram, chatID, thread)
+		caption := telegramCaption(route, msg, true, quote)
+		if utf16Len(caption) > telegramCaptionLimit {
+			caption = telegramCaption(route, msg, false, quote)
+		}
+		return b.editCopy(b.telegram, chatID, msg, telegramTexts(route, msg, quote), caption)
+	case MessageDeleted:
+		text := deletedText
+		if target == b.telegram {
+			text = escapeMarkdownV2(deletedText)
+		}
+		return b.deleteCopies(target, chatID, route.OnDelete, msg, text)
+	case MessageReacted:
+		// Реакция учитывается один раз, повторная попытка только применяет её
+		if job.Attempts == 0 && !b.store.React(RefOf(msg), chatID, msg.ReactionsAdded, msg.ReactionsRemoved) {
+			return nil
+		}
+		return b.react(target, chatID, msg)
+	}
+	return nil
+}
+
+// toTelegram отправка сообщения Discord в чат Telegram по маршруту.
+// Если есть вложения, текст сообщения уходит в подпись первого из них, а
+// слишком длинный текст отдельным сообщением после вложений. Вложения,
+// превышающие ограничения Telegram, добавляются к тексту ссылками
+func (b *Bridge) toTelegram(route *Route, msg *Message) error {
+	chatID := route.TelegramChat()
+	opts, quote := b.reply(msg, b.telegram, chatID, b.thread(route, msg, true))
+
+	var files []*Attachment
+	for _, attachment := range msg.Attachments {
+		if fitsTelegram(attachment) {
+			files = append(files, attachment)
+		}
+	}
+	hasText := msg.Text != "" || len(files) < len(msg.Attachments)
+
+	if len(files) == 0 && hasText {
+		if err := b.sendTexts(b.telegram, chatID, msg, telegramTexts(route, msg, quote), opts, CopyText); err != nil {
+			return fmt.Errorf("failed to send message to Telegram chat %s: %w", chatID, err)
+		}
+	}
+
+	if len(files) > 0 {
+		caption := telegramCaption(route, msg, hasText, quote)
+		followUp := utf16Len(caption) > telegramCaptionLimit
+		if followUp {
+			caption = telegramCaption(route, msg, false, quote)
+		}
+
+		ids, err := b.telegram.SendFiles(chatID, files, caption, opts)
+		if err != nil && len(ids) == 0 {
+			return fmt.Errorf("failed to send files to Telegram chat %s: %w", chatID, err)
+		}
+		if err != nil {
+			// Часть файлов уже отправлена, повтор привёл бы к дубликатам
+			log.Printf("Failed to send some files to Telegram chat %s: %v", chatID, err)
+		}
+		for i, id := range ids {
+			kind := CopyFile
+			if i == 0 && hasText && !followUp {
+				kind = CopyCaption
+			}
+			b.record(msg, b.telegram, chatID, opts.ThreadID, id, kind)
+		}
+
+		if followUp {
+			if err := b.sendTexts(b.telegram, chatID, msg, telegramTexts(route, msg, quote), continuation(opts), CopyText); err != nil {
+				log.Printf("Failed to send text of message with files to Telegram chat %s: %v", chatID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// toDiscord отправка сообщения Telegram в канал Discord по маршруту.
+// Вложения отправляются одним сообщением, текст становится его подписью.
+// Длинный текст делится на несколько сообщений
+func (b *Bridge) toDiscord(route *Route, msg *Message) error {
+	channelID := route.DiscordChannelID
+	if len(msg.Attachments) == 0 && msg.Text == "" && len(msg.Embeds) == 0 {
+		return nil
+	}
+	opts, quote := b.reply(msg, b.discord, channelID, b.thread(route, msg, true))
+	opts.Embeds = msg.Embeds
+	if route.Format.Webhook {
+		// Вебхук не может отвечать на сообщения, поэтому ответ заменяется цитатой
+		if opts.ReplyTo != "" {
+			opts.ReplyTo = ""
+			quote = msg.ReplyTo
+		}
+		opts.Username = displayName(route, msg.Sender)
+		opts.AvatarURL = msg.Sender.AvatarURL
+	}
+	texts := discordTexts(route, msg, quote)
+
+	var downloads []*Attachment
+	for _, attachment := range msg.Attachments {
+		if downloadable(attachment) {
+			downloads = append(downloads, attachment)
+		}
+	}
+	if len(downloads) == 0 {
+		if err := b.sendTexts(b.discord, channelID, msg, texts, opts, CopyText); err != nil {
+			return fmt.Errorf("failed to send text message to Discord channel %s: %w", channelID, err)
+		}
+		return nil
+	}
+
+	files, err := fileURLs(b.telegram, downloads)
+	if err != nil {
+		return fmt.Errorf("failed to get files for Discord channel %s: %w", channelID, err)
+	}
+	ids, err := b.discord.SendFiles(channelID, files, texts[0], opts)
+	if err != nil && len(ids) == 0 {
+		return fmt.Errorf("failed to send files to Discord channel %s: %w", channelID, err)
+	}
+	if err != nil {
+		// Часть файлов уже отправлена, повтор привёл бы к дубликатам
+		log.Printf("Failed to send some files to Discord channel %s: %v", channelID, err)
+	}
+	for i, id := range ids {
+		kind := CopyFile
+		if i == 0 {
+			kind = CopyCaption
+		}
+		b.record(msg, b.discord, channelID, opts.ThreadID, id, kind)
+	}
+
+	// Продолжение подписи, если она не уместилась в одно сообщение
+	if err := b.sendTexts(b.discord, channelID, msg, texts[1:], continuation(opts), CopyPart); err != nil {
+		log.Printf("Failed to send text of message with files to Discord channel %s: %v", channelID, err)
+	}
+	return nil
+}
+
+// fileURLs возвращает копии вложений со ссылками для скачивания, которые
+// платформа source выдаёт только перед отправкой
+func fileURLs(source Platform, attachments []*Attachment) ([]*Attachment, error) {
+	files := make([]*Attachment, len(attachments))
+	for i, attachment := range attachments {
+		url, err := source.FileURL(attachment)
+		if err != nil {
+			return nil, err
+		}
+		file := *attachment
+		file.URL = url
+		files[i] = &file
+	}
+	return files, nil
+}
+
+// sendTexts отправляет части текста отдельными сообщениями. Первая часть
+// отправляется с opts и сохраняется как копия вида kind, остальные как
+// продолжение. Ошибка возвращается, только если не отправлено ничего
+func (b *Bridge) sendTexts(target Platform, chatID string, msg *Message, texts []string, opts SendOptions, kind string) error {
+	for i, text := range texts {
+		id, err := target.SendText(chatID, text, opts)
+		if err != nil && i == 0 {
+			return err
+		}
+		if err != nil {
+			// Начало текста уже отправлено, повтор привёл бы к дубликатам
+			log.Printf("Failed to send part %d of message to %s chat %s: %v", i+1, target.Name(), chatID, err)
+			return nil
+		}
+		b.record(msg, target, chatID, opts.ThreadID, id, kind)
+		kind = CopyPart
+		opts = continuation(opts)
+	}
+	return nil
+}
+
+// continuation параметры отправки продолжения сообщения: без ответа и
+// встраиваний, но от имени того же автора и в той же ветке
+func continuation(opts SendOptions) SendOptions {
+	return SendOptions{Username: opts.Username, AvatarURL: opts.AvatarURL, ThreadID: opts.ThreadID}
+}
+
+// thread возвращает ветку Discord или тему Telegram, связанную с веткой
+// сообщения, в чате назначения маршрута. Если связи нет и create, ветка
+// создаётся. Пустая строка означает основной канал или чат. Задачи одного
+// чата назначения выполняются по очереди, поэтому ветка не создаётся дважды.
+// Неудачная попытка запоминается до перезапуска, чтобы не повторять её для
+// каждого сообщения ветки
+func (b *Bridge) thread(route *Route, msg *Message, create bool) string {
+	if msg.ThreadID == "" {
+		return ""
+	}
+	failedKey := fmt.Sprintf("%s:%s:%s:%s", route.DiscordChannelID, route.TelegramChat(), msg.Platform, msg.ThreadID)
+	b.failedThreadsMu.Lock()
+	failed := b.failedThreads[failedKey]
+	b.failedThreadsMu.Unlock()
+	if failed {
+		create = false
+	}
+
+	link := &ThreadLink{DiscordChannelID: route.DiscordChannelID, TelegramChatID: route.TelegramChat()}
+	var err error
+	if msg.Platform == PlatformDiscord {
+		link.DiscordThreadID = msg.ThreadID
+		link.TelegramTopicID = b.threads.TelegramTopic(link.DiscordChannelID, link.TelegramChatID, msg.ThreadID)
+		if link.TelegramTopicID != "" || !create {
+			return link.TelegramTopicID
+		}
+		link.TelegramTopicID, err = b.telegram.CreateThread(link.TelegramChatID, msg.ThreadName)
+	} else {
+		link.TelegramTopicID = msg.ThreadID
+		link.DiscordThreadID = b.threads.DiscordThread(link.DiscordChannelID, link.TelegramChatID, msg.ThreadID)
+		if link.DiscordThreadID != "" || !create {
+			return link.DiscordThreadID
+		}
+		link.DiscordThreadID, err = b.discord.CreateThread(link.DiscordChannelID, msg.ThreadName)
+	}
+	if err != nil {
+		// Например, чат Telegram не является форумом: сообщение уходит в сам чат
+		log.Printf("Failed to create thread %q for %s thread %s: %v", msg.ThreadName, msg.Platform, msg.ThreadID, err)
+		b.failedThreadsMu.Lock()
+		b.failedThreads[failedKey] = true
+		b.failedThreadsMu.Unlock()
+		return ""
+	}
+
+	b.threads.Add(link)
+	if msg.Platform == PlatformDiscord {
+		return link.TelegramTopicID
+	}
+	return link.DiscordThreadID
+}
+
+// withMentions возвращает копию сообщения, в которой упоминания связанных
+// пользователей указывают на их аккаунты на платформе target. Упоминания
+// остальных пользователей остаются обычным текстом
+func (b *Bridge) withMentions(msg *Message, target Platform) *Message {
+	if len(msg.Entities) == 0 {
+		return msg
+	}
+
+	bridged := *msg
+	bridged.Entities = nil
+	for _, entity := range msg.Entities {
+		if entity.Type != EntityMention {
+			bridged.Entities = append(bridged.Entities, entity)
+			continue
+		}
+
+		switch target.Name() {
+		case PlatformDiscord:
+			if id := b.identities.DiscordID(entity.UserID, entityText(msg.Text, entity)); id != "" {
+				entity.UserID = id
+				bridged.Entities = append(bridged.Entities, entity)
+			}
+		case PlatformTelegram:
+			// В Telegram упоминание без имени пользователя делается ссылкой tg://user
+			if id := b.identities.TelegramID(entity.UserID); id != "" {
+				bridged.Entities = append(bridged.Entities, Entity{
+					Type:   EntityTextLink,
+					Offset: entity.Offset,
+					Length: entity.Length,
+					URL:    "tg://user?id=" + id,
+				})
+			}
+		}
+	}
+	return &bridged
+}
+
+// withProfile возвращает копию сообщения, автор которой показан под профилем
+// своего связанного аккаунта на платформе target
+func (b *Bridge) withProfile(msg *Message, target Platform) *Message {
+	if msg.Kind != MessageCreated && msg.Kind != MessageEdited {
+		return msg
+	}
+
+	var linkedID string
+	switch target.Name() {
+	case PlatformDiscord:
+		linkedID = b.identities.DiscordID(msg.Sender.ID, msg.Sender.Username)
+	case PlatformTelegram:
+		linkedID = b.identities.TelegramID(msg.Sender.ID)
+	}
+	if linkedID == "" {
+		return msg
+	}
+
+	profile := b.profile(target, linkedID)
+	if profile == nil {
+		return msg
+	}
+	bridged := *msg
+	bridged.Sender = *profile
+	return &bridged
+}
+
+// profile возвращает профиль пользователя платформы из кэша или запрашивает его
+func (b *Bridge) profile(platform Platform, userID string) *Sender {
+	key := platform.Name() + ":" + userID
+	b.profilesMu.Lock()
+	cached, exists := b.profiles[key]
+	b.profilesMu.Unlock()
+	if exists && time.Since(cached.fetched) < profileTTL {
+		return cached.sender
+	}
+
+	sender, err := platform.ResolveUser(userID)
+	if err != nil {
+		// Ошибку тоже кэшируем, чтобы не запрашивать платформу на каждое сообщение
+		log.Printf("Failed to resolve linked %s user %s: %v", platform.Name(), userID, err)
+		sender = nil
+	}
+
+	b.profilesMu.Lock()
+	b.profiles[key] = &cachedProfile{sender: sender, fetched: time.Now()}
+	b.profilesMu.Unlock()
+	return sender
+}
+
+// reply ищет копию сообщения, на которое отвечает msg, в чате назначения.
+// Если копия известна и находится в той же ветке thread, возвращает параметры
+// отправки ответа, иначе исходное сообщение для цитаты
+func (b *Bridge) reply(msg *Message, target Platform, chatID, thread string) (SendOptions, *ReplyInfo) {
+	if msg.ReplyTo == nil {
+		return SendOptions{ThreadID: thread}, nil
+	}
+
+	parent := MessageRef{Platform: msg.Platform, ChatID: msg.ChatID, ID: msg.ReplyTo.ID}
+	if mirror := b.store.Mirror(parent, target.Name(), chatID); mirror.ID != "" && mirror.Thread == thread {
+		return SendOptions{ReplyTo: mirror.ID, ThreadID: thread}, nil
+	}
+	return SendOptions{ThreadID: thread}, msg.ReplyTo
+}
+
+// record сохраняет связь исходного сообщения с отправленной копией
+func (b *Bridge) record(msg *Message, target Platform, chatID, thread, id, kind string) {
+	b.store.Add(RefOf(msg), MessageRef{Platform: target.Name(), ChatID: chatID, ID: id, Kind: kind, Thread: thread})
+}
+
+// location ID чата для запросов к сообщению ref. В Discord ветка является
+// отдельным каналом, а в Telegram сообщения темы адресуются по ID чата
+func location(ref MessageRef) string {
+	if ref.Platform == PlatformDiscord && ref.Thread != "" {
+		return ref.Thread
+	}
+	return ref.ChatID
+}
+
+// editCopy повторяет редактирование исходного сообщения на его копиях в чате.
+// Подпись вложения получает caption, текстовые копии по порядку получают части
+// texts. Если частей стало больше, чем копий, лишние части не отправляются
+func (b *Bridge) editCopy(target Platform, chatID string, msg *Message, texts []string, caption string) error {
+	first, part := true, 0
+	for _, bridged := range b.store.Copies(RefOf(msg)) {
+		if bridged.Platform != target.Name() || bridged.ChatID != chatID {
+			continue
+		}
+
+		var err error
+		switch {
+		case bridged.Kind == CopyText || bridged.Kind == CopyPart:
+			if part < len(texts) {
+				err = target.EditText(location(bridged), bridged.ID, texts[part])
+			}
+			part++
+		case bridged.Kind == CopyCaption:
+			err = target.EditCaption(location(bridged), bridged.ID, caption)
+			part++
+		case first:
+			// Вложение без текста может получить подпись при редактировании
+			err = target.EditCaption(location(bridged), bridged.ID, caption)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to edit message %s in %s chat %s: %w", bridged.ID, target.Name(), chatID, err)
+		}
+		first = false
+	}
+	return nil
+}
+
+// deleteCopies удаляет копии исходного сообщения в чате или, если маршрут
+// настроен на пометку, заменяет их текст на deletedText. Обработанные копии
+// удаляются из хранилища
+func (b *Bridge) deleteCopies(target Platform, chatID, action string, msg *Message, text string) error {
+	for _, bridged := range b.store.Copies(RefOf(msg)) {
+		if bridged.Platform != target.Name() || bridged.ChatID != chatID {
+			continue
+		}
+
+		var err error
+		switch {
+		case action == OnDeleteRemove:
+			err = target.DeleteMessage(location(bridged), bridged.ID)
+		case bridged.Kind == CopyText || bridged.Kind == CopyPart:
+			err = target.EditText(location(bridged), bridged.ID, text)
+		default:
+			err = target.EditCaption(location(bridged), bridged.ID, deletedText)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete message %s in %s chat %s: %w", bridged.ID, target.Name(), chatID, err)
+		}
+		b.store.RemoveCopy(RefOf(msg), bridged)
+	}
+	return nil
+}
+
+// react повторяет реакции на связанном сообщении в чате назначения
+func (b *Bridge) react(target Platform, chatID string, msg *Message) error {
+	mirror := b.store.Mirror(RefOf(msg), target.Name(), chatID)
+	if mirror.ID == "" {
+		return nil
+	}
+	emojis := b.store.Reactions(RefOf(msg), chatID)
+	if err := target.SetReactions(location(mirror), mirror.ID, emojis); err != nil {
+		return fmt.Errorf("failed to set reactions on message %s in %s chat %s: %w", mirror.ID, target.Name(), chatID, err)
+	}
+	return nil
+}
+
+// Максимальная длина цитаты сообщения, на которое отвечают
+const quoteLength = 80
+
+// snippet сокращает текст до одной строки для цитаты
+func snippet(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) > quoteLength {
+		return string(runes[:quoteLength]) + "…"
+	}
+	return text
+}
+
+// quoteName имя автора цитируемого сообщения
+func quoteName(quote *ReplyInfo) string {
+	if name := senderName(quote.Sender); name != "" {
+		return name
+	}
+	return "…"
+}
+
+// telegramTexts текст сообщения Discord для Telegram в формате MarkdownV2,
+// разделённый на части по ограничению длины сообщения
+func telegramTexts(route *Route, msg *Message, quote *ReplyInfo) []string {
+	header := ""
+	if quote != nil {
+		header += fmt.Sprintf(">*%s*: %s\n", escapeMarkdownV2(quoteName(quote)), escapeMarkdownV2(snippet(quote.Text)))
+	}
+	header += escapeMarkdownV2(route.Format.TelegramPrefix) + "\n"
+	if !route.Format.HideSender {
+		header += fmt.Sprintf("*%s*: ", escapeMarkdownV2(displayName(route, msg.Sender)))
+	}
+
+	// Telegram считает длину без разметки, поэтому длина заголовка с
+	// разметкой берётся с запасом
+	chunks := splitText(msg.Text+fileLinks(msg), msg.Entities, telegramMessageLimit-utf16Len(header), telegramMessageLimit)
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = renderMarkdownV2(chunk.Text, chunk.Entities)
+	}
+	texts[0] = header + texts[0]
+	return texts
+}
+
+// fileLinks ссылки на вложения, которые нельзя отправить в Telegram файлом
+func fileLinks(msg *Message) string {
+	links := ""
+	for _, attachment := range msg.Attachments {
+		if !fitsTelegram(attachment) {
+			links += fmt.Sprintf("\n📎 %s (%.1f MB): %s", attachment.Name, float64(attachment.Size)/(1<<20), attachment.URL)
+		}
+	}
+	return links
+}
+
+// fileStubs описания вложений Telegram, которые бот не может скачать
+func fileStubs(msg *Message) string {
+	stubs := ""
+	for _, attachment := range msg.Attachments {
+		if !downloadable(attachment) {
+			stubs += fmt.Sprintf("\n📎 %s (%.1f MB): файл слишком большой для пересылки", attachment.Name, float64(attachment.Size)/(1<<20))
+		}
+	}
+	return stubs
+}
+
+// telegramCaption подпись вложения из Discord для Telegram
+func telegramCaption(route *Route, msg *Message, withText bool, quote *ReplyInfo) string {
+	caption := ""
+	if quote != nil && withText {
+		caption += fmt.Sprintf("↩ %s: %s\n", quoteName(quote), snippet(quote.Text))
+	}
+	caption += route.Format.TelegramPrefix
+	if !route.Format.HideSender {
+		caption += fmt.Sprintf("\n %s", displayName(route, msg.Sender))
+		if withText && msg.Text != "" {
+			caption += ":"
+		}
+	}
+	if withText && msg.Text != "" {
+		caption += " " + msg.Text
+	}
+	if withText {
+		caption += fileLinks(msg)
+	}
+	return caption
+}
+
+// senderName отображаемое имя автора
+func senderName(sender Sender) string {
+	if sender.Name != "" {
+		return sender.Name
+	}
+	return sender.Username
+}
+
+// displayName имя автора для подписи пересланного сообщения. Если маршрут
+// настроен на это, к имени добавляется короткий идентификатор автора
+func displayName(route *Route, sender Sender) string {
+	name := senderName(sender)
+	if name == "" {
+		name = "Аноним"
+	}
+	if route.Format.ShowSenderID && sender.ID != "" {
+		name += " #" + shortID(sender.ID)
+	}
+	return name
+}
+
+// shortID короткий постоянный идентификатор по ID автора
+func shortID(id string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(id))
+	return fmt.Sprintf("%04x", hash.Sum32()&0xffff)
+}
+
+// onlyVoices состоит ли сообщение только из голосовых сообщений
+func onlyVoices(msg *Message) bool {
+	for _, attachment := range msg.Attachments {
+		if !attachment.Voice {
+			return false
+		}
+	}
+	return len(msg.Attachments) > 0
+}
+
+// discordTexts текст сообщения Telegram для Discord, разделённый на части по
+// ограничению длины сообщения. Для вложений без текста это подпись с именем автора
+func discordTexts(route *Route, msg *Message, quote *ReplyInfo) []string {
+	text := msg.Text + fileStubs(msg)
+	if msg.Text == "" {
+		text = strings.TrimPrefix(text, "\n")
+	}
+	header := ""
+	if quote != nil {
+		header += fmt.Sprintf("> **%s**: %s\n", discordEscaper.Replace(quoteName(quote)), discordEscaper.Replace(snippet(quote.Text)))
+	}
+
+	// Через вебхук имя автора видно и так. Голосовые сообщения бот отправляет
+	// сам, без вебхука, поэтому у них без текста автор указывается в подписи
+	if !route.Format.Webhook || text == "" && onlyVoices(msg) {
+		if text == "" {
+			if route.Format.HideSender {
+				return []string{header + route.Format.DiscordPrefix}
+			}
+			return []string{header + fmt.Sprintf("%s %s:", route.Format.DiscordPrefix, discordEscaper.Replace(displayName(route, msg.Sender)))}
+		}
+
+		header += route.Format.DiscordPrefix + " \n"
+		if !route.Format.HideSender {
+			header += fmt.Sprintf("**%s**: ", discordEscaper.Replace(displayName(route, msg.Sender)))
+		}
+	}
+
+	texts := splitRendered(text, msg.Entities, discordMessageLimit-utf16Len(header), discordMessageLimit, renderDiscordMarkdown)
+	texts[0] = header + texts[0]
+	return texts
+}
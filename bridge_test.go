@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestBridge мост между двумя платформами в памяти по маршрутам routes
+func newTestBridge(t *testing.T, routes ...*Route) (*Bridge, *MemoryPlatform, *MemoryPlatform) {
+	t.Helper()
+	for _, route := range routes {
+		if err := route.normalize(); err != nil {
+			t.Fatalf("invalid route: %v", err)
+		}
+	}
+	discord, telegram := NewMemoryPlatform(PlatformDiscord), NewMemoryPlatform(PlatformTelegram)
+	bridge := NewBridge(discord, telegram, NewRoutes(routes), NewMessageStore(), NewIdentities(), NewThreads(), NewDeliveryQueue(), NewFilters(t.TempDir()+"/filters.json"))
+	return bridge, discord, telegram
+}
+
+// deliverTo выполняет доставку сообщения по маршруту без очереди
+func deliverTo(t *testing.T, b *Bridge, target string, route *Route, msg *Message) {
+	t.Helper()
+	err := b.deliver(&DeliveryJob{Target: target, DiscordChannelID: route.DiscordChannelID, TelegramChatID: route.TelegramChatID, Message: msg})
+	if err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+}
+
+// waitSent ждёт, пока платформа отправит count сообщений
+func waitSent(t *testing.T, platform *MemoryPlatform, count int) []SentMessage {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		sent := platform.Sent()
+		if len(sent) >= count || time.Now().After(deadline) {
+			// Даём очереди время отправить лишнее, если оно есть
+			time.Sleep(50 * time.Millisecond)
+			return platform.Sent()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBridgeRouting(t *testing.T) {
+	b, discord, telegram := newTestBridge(t,
+		&Route{DiscordChannelID: "c1", TelegramChatID: -100},
+		&Route{DiscordChannelID: "c1", TelegramChatID: -200, Direction: DirectionToTelegram},
+		&Route{DiscordChannelID: "c2", TelegramChatID: -300, Direction: DirectionToDiscord},
+	)
+
+	discord.Receive(&Message{Kind: MessageCreated, ChatID: "c1", ID: "1", Sender: Sender{ID: "u1", Name: "Alice"}, Text: "from c1"})
+	discord.Receive(&Message{Kind: MessageCreated, ChatID: "c2", ID: "2", Sender: Sender{ID: "u1", Name: "Alice"}, Text: "from c2"})
+	discord.Receive(&Message{Kind: MessageCreated, ChatID: "c3", ID: "3", Sender: Sender{ID: "u1", Name: "Alice"}, Text: "unrouted"})
+	telegram.Receive(&Message{Kind: MessageCreated, ChatID: "-200", ID: "4", Sender: Sender{ID: "u2", Name: "Bob"}, Text: "from -200"})
+	telegram.Receive(&Message{Kind: MessageCreated, ChatID: "-300", ID: "5", Sender: Sender{ID: "u2", Name: "Bob"}, Text: "from -300"})
+	discord.Close()
+	telegram.Close()
+	b.Run()
+
+	toTelegram := waitSent(t, telegram, 2)
+	chats := map[string]bool{}
+	for _, sent := range toTelegram {
+		if !strings.Contains(sent.Text, "from c1") {
+			t.Errorf("unexpected message in Telegram chat %s: %q", sent.ChatID, sent.Text)
+		}
+		chats[sent.ChatID] = true
+	}
+	if len(toTelegram) != 2 || !chats["-100"] || !chats["-200"] {
+		t.Errorf("message from c1 should reach -100 and -200, got %+v", toTelegram)
+	}
+
+	toDiscord := waitSent(t, discord, 1)
+	if len(toDiscord) != 1 || toDiscord[0].ChatID != "c2" || !strings.Contains(toDiscord[0].Text, "from -300") {
+		t.Errorf("only message from -300 should reach c2, got %+v", toDiscord)
+	}
+}
+
+func TestBridgeEditReplay(t *testing.T) {
+	route := &Route{DiscordChannelID: "c1", TelegramChatID: -100}
+	b, discord, _ := newTestBridge(t, route)
+
+	msg := &Message{Kind: MessageCreated, Platform: PlatformTelegram, ChatID: "-100", ID: "10", Sender: Sender{ID: "u2", Name: "Bob"}, Text: "first"}
+	deliverTo(t, b, PlatformDiscord, route, msg)
+
+	edited := *msg
+	edited.Kind = MessageEdited
+	edited.Text = "second"
+	deliverTo(t, b, PlatformDiscord, route, &edited)
+
+	sent := discord.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("edit should not send new messages, got %+v", sent)
+	}
+	if sent[0].Edits != 1 || !strings.Contains(sent[0].Text, "second") || strings.Contains(sent[0].Text, "first") {
+		t.Errorf("copy was not edited: %+v", sent[0])
+	}
+}
+
+func TestBridgeFileURLs(t *testing.T) {
+	route := &Route{DiscordChannelID: "c1", TelegramChatID: -100}
+	b, discord, _ := newTestBridge(t, route)
+
+	msg := &Message{Kind: MessageCreated, Platform: PlatformTelegram, ChatID: "-100", ID: "15", Sender: Sender{ID: "u2", Name: "Bob"},
+		Attachments: []*Attachment{{Name: "photo.jpg", FileID: "f1", ContentType: "image/jpeg"}}}
+	deliverTo(t, b, PlatformDiscord, route, msg)
+
+	sent := discord.Sent()
+	if len(sent) != 1 || len(sent[0].Files) != 1 || sent[0].Files[0].URL != "memory://telegram/f1" {
+		t.Fatalf("file URL should be resolved at delivery, got %+v", sent)
+	}
+	if msg.Attachments[0].URL != "" {
+		t.Errorf("resolved URL should not be stored in the job, got %q", msg.Attachments[0].URL)
+	}
+}
+
+func TestBridgeLargeTelegramFile(t *testing.T) {
+	route := &Route{DiscordChannelID: "c1", TelegramChatID: -100}
+	b, discord, _ := newTestBridge(t, route)
+
+	msg := &Message{Kind: MessageCreated, Platform: PlatformTelegram, ChatID: "-100", ID: "17", Sender: Sender{ID: "u2", Name: "Bob"},
+		Attachments: []*Attachment{{Name: "movie.mp4", FileID: "big", ContentType: "video/mp4", Size: 30 << 20}}}
+	deliverTo(t, b, PlatformDiscord, route, msg)
+
+	sent := discord.Sent()
+	if len(sent) != 1 || len(sent[0].Files) != 0 || !strings.Contains(sent[0].Text, "movie.mp4") || !strings.Contains(sent[0].Text, "30.0 MB") {
+		t.Errorf("large file should be replaced with a placeholder, got %+v", sent)
+	}
+}
+
+func TestBridgeWebhookVoiceSender(t *testing.T) {
+	route := &Route{DiscordChannelID: "c1", TelegramChatID: -100, Format: RouteFormat{Webhook: true}}
+	b, discord, _ := newTestBridge(t, route)
+
+	msg := &Message{Kind: MessageCreated, Platform: PlatformTelegram, ChatID: "-100", ID: "16", Sender: Sender{ID: "u2", Name: "Bob"},
+		Attachments: []*Attachment{{Name: "voice.ogg", FileID: "v1", ContentType: "audio/ogg", Voice: true}}}
+	deliverTo(t, b, PlatformDiscord, route, msg)
+
+	sent := discord.Sent()
+	if len(sent) != 1 || !strings.Contains(sent[0].Caption, "Bob") {
+		t.Errorf("voice without text should be captioned with its sender, got %+v", sent)
+	}
+}
+
+func TestBridgeDeleteReplay(t *testing.T) {
+	tests := []struct {
+		onDelete string
+		deleted  bool
+		text     string
+	}{
+		{OnDeleteRemove, true, ""},
+		{OnDeleteMark, false, escapeMarkdownV2(deletedText)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.onDelete, func(t *testing.T) {
+			route := &Route{DiscordChannelID: "c1", TelegramChatID: -100, OnDelete: tt.onDelete}
+			b, _, telegram := newTestBridge(t, route)
+
+			msg := &Message{Kind: MessageCreated, Platform: PlatformDiscord, ChatID: "c1", ID: "20", Sender: Sender{ID: "u1", Name: "Alice"}, Text: "hello"}
+			deliverTo(t, b, PlatformTelegram, route, msg)
+			deliverTo(t, b, PlatformTelegram, route, &Message{Kind: MessageDeleted, Platform: PlatformDiscord, ChatID: "c1", ID: "20"})
+
+			sent := telegram.Sent()
+			if len(sent) != 1 {
+				t.Fatalf("expected one copy, got %+v", sent)
+			}
+			if sent[0].Deleted != tt.deleted || tt.text != "" && sent[0].Text != tt.text {
+				t.Errorf("unexpected copy after delete: %+v", sent[0])
+			}
+			if copies := b.store.Copies(RefOf(msg)); len(copies) != 0 {
+				t.Errorf("copies should be forgotten after delete, got %+v", copies)
+			}
+		})
+	}
+}
+
+func TestBridgeReplyMapping(t *testing.T) {
+	route := &Route{DiscordChannelID: "c1", TelegramChatID: -100}
+	b, discord, telegram := newTestBridge(t, route)
+
+	// Ответ на пересланное сообщение становится ответом на его копию
+	original := &Message{Kind: MessageCreated, Platform: PlatformDiscord, ChatID: "c1", ID: "30", Sender: Sender{ID: "u1", Name: "Alice"}, Text: "question"}
+	deliverTo(t, b, PlatformTelegram, route, original)
+	copyID := telegram.Sent()[0].ID
+
+	reply := &Message{Kind: MessageCreated, Platform: PlatformDiscord, ChatID: "c1", ID: "31", Sender: Sender{ID: "u3", Name: "Carol"}, Text: "answer",
+		ReplyTo: &ReplyInfo{ID: "30", Sender: original.Sender, Text: original.Text}}
+	deliverTo(t, b, PlatformTelegram, route, reply)
+	if sent := telegram.Sent()[1]; sent.ReplyTo != copyID || strings.Contains(sent.Text, "question") {
+		t.Errorf("reply should point to copy %s without a quote, got %+v", copyID, sent)
+	}
+
+	// Ответ на копию в обратную сторону указывает на исходное сообщение
+	back := &Message{Kind: MessageCreated, Platform: PlatformTelegram, ChatID: "-100", ID: "32", Sender: Sender{ID: "u2", Name: "Bob"}, Text: "got it",
+		ReplyTo: &ReplyInfo{ID: copyID, Text: "question"}}
+	deliverTo(t, b, PlatformDiscord, route, back)
+	if sent := discord.Sent()[0]; sent.ReplyTo != "30" {
+		t.Errorf("reply to copy should point to original 30, got %+v", sent)
+	}
+
+	// Ответ на сообщение, которое не пересылалось, становится цитатой
+	unknown := &Message{Kind: MessageCreated, Platform: PlatformDiscord, ChatID: "c1", ID: "33", Sender: Sender{ID: "u1", Name: "Alice"}, Text: "see above",
+		ReplyTo: &ReplyInfo{ID: "99", Sender: Sender{Name: "Dave"}, Text: "old news"}}
+	deliverTo(t, b, PlatformTelegram, route, unknown)
+	if sent := telegram.Sent()[2]; sent.ReplyTo != "" || !strings.Contains(sent.Text, "Dave") || !strings.Contains(sent.Text, "old news") {
+		t.Errorf("reply to unknown message should be quoted, got %+v", sent)
+	}
+}
+
+func TestBridgeThreadFailureCached(t *testing.T) {
+	route := &Route{DiscordChannelID: "c1", TelegramChatID: -100}
+	b, _, telegram := newTestBridge(t, route)
+	telegram.threadErr = errors.New("Bad Request: the chat is not a forum")
+
+	for i, id := range []string{"40", "41", "42"} {
+		msg := &Message{Kind: MessageCreated, Platform: PlatformDiscord, ChatID: "c1", ID: id, Sender: Sender{ID: "u1", Name: "Alice"},
+			Text: "in thread", ThreadID: "t1", ThreadName: "Topic"}
+		deliverTo(t, b, PlatformTelegram, route, msg)
+		if sent := telegram.Sent(); len(sent) != i+1 || sent[i].ThreadID != "" {
+			t.Fatalf("message should go to the chat itself, got %+v", sent)
+		}
+	}
+	if telegram.threadCalls != 1 {
+		t.Errorf("CreateThread called %d times, want 1", telegram.threadCalls)
+	}
+}
+
+func TestBridgeReactionAfterQueuedCreate(t *testing.T) {
+	b, discord, telegram := newTestBridge(t,
+		&Route{DiscordChannelID: "c1", TelegramChatID: -100},
+		&Route{DiscordChannelID: "c1", TelegramChatID: -200},
+	)
+
+	// Реакция приходит, пока создание сообщения ещё ждёт в очереди
+	discord.Receive(&Message{Kind: MessageCreated, ChatID: "c1", ID: "50", Sender: Sender{ID: "u1", Name: "Alice"}, Text: "vote"})
+	discord.Receive(&Message{Kind: MessageReacted, ChatID: "c1", ID: "50", Sender: Sender{ID: "u3"}, ReactionsAdded: []string{"👍"}})
+	discord.Close()
+	telegram.Close()
+	b.Run()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		sent := telegram.Sent()
+		done := len(sent) == 2
+		for _, copy := range sent {
+			done = done && len(copy.Reactions) == 1
+		}
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("reaction should reach every copy once, got %+v", sent)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := b.store.Reactions(MessageRef{Platform: PlatformDiscord, ChatID: "c1", ID: "50"}, "-100"); len(got) != 1 || got[0] != "👍" {
+		t.Errorf("reaction should be recorded for chat -100, got %v", got)
+	}
+}
+
+func TestDiscordTextsEscapeHeader(t *testing.T) {
+	route := &Route{DiscordChannelID: "c1", TelegramChatID: -100}
+	if err := route.normalize(); err != nil {
+		t.Fatal(err)
+	}
+	msg := &Message{Platform: PlatformTelegram, Sender: Sender{ID: "u2", Name: "**Bob**"}, Text: "hi"}
+	quote := &ReplyInfo{Sender: Sender{Name: "__Dave__"}, Text: "ping <@42> ||spoiler||"}
+
+	header := discordTexts(route, msg, quote)[0]
+	for _, unescaped := range []string{"****Bob****", "**__Dave__**", " <@42>", " ||spoiler||"} {
+		if strings.Contains(header, unescaped) {
+			t.Errorf("header %q contains unescaped %q", header, unescaped)
+		}
+	}
+	if text, _ := parseDiscordMarkdown(header, nil); !strings.Contains(text, "**Bob**") || !strings.Contains(text, "<@42>") {
+		t.Errorf("escaped header %q lost its text: %q", header, text)
+	}
+}
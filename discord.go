@@ -0,0 +1,878 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// CommandHandler обработчик команд Discord. Возвращает true, если сообщение
+// было командой и не должно уходить в мост
+type CommandHandler func(s *discordgo.Session, m *discordgo.MessageCreate) bool
+
+// Структура для платформы Discord поверх discordgo
+type DiscordPlatform struct {
+	session  *discordgo.Session
+	messages chan *Message
+	commands CommandHandler
+
+	webhooksMu sync.Mutex
+	webhooks   map[string]*discordgo.Webhook // вебхуки моста по ID канала, nil если вебхука нет
+
+	// События сообщений в порядке поступления. Обработка делает запросы к API,
+	// поэтому выполняется вне цикла событий discordgo, но строго по очереди,
+	// чтобы правка или удаление не обогнали создание сообщения
+	events chan func()
+}
+
+// Имя вебхука, через который мост отправляет сообщения от имени пользователей
+const bridgeWebhookName = "ChinaScout Bridge"
+
+// Создание платформы Discord и регистрация обработчиков сообщений. Порядок
+// событий сохраняется, только если у сессии включены SyncEvents
+func NewDiscordPlatform(session *discordgo.Session) *DiscordPlatform {
+	d := &DiscordPlatform{
+		session:  session,
+		messages: make(chan *Message, 100),
+		webhooks: make(map[string]*discordgo.Webhook),
+		events:   make(chan func(), 1000),
+	}
+	session.AddHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) {
+		d.events <- func() { d.onMessageCreate(s, m) }
+	})
+	session.AddHandler(func(s *discordgo.Session, m *discordgo.MessageUpdate) {
+		d.events <- func() { d.onMessageUpdate(s, m) }
+	})
+	session.AddHandler(func(s *discordgo.Session, m *discordgo.MessageDelete) {
+		d.events <- func() { d.onMessageDelete(s, m) }
+	})
+	session.AddHandler(func(s *discordgo.Session, m *discordgo.MessageDeleteBulk) {
+		d.events <- func() { d.onMessageDeleteBulk(s, m) }
+	})
+	session.AddHandler(func(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+		d.events <- func() { d.onReactionAdd(s, r) }
+	})
+	session.AddHandler(func(s *discordgo.Session, r *discordgo.MessageReactionRemove) {
+		d.events <- func() { d.onReactionRemove(s, r) }
+	})
+	go func() {
+		for handle := range d.events {
+			handle()
+		}
+	}()
+	return d
+}
+
+// SetCommandHandler задаёт обработчик команд, который вызывается до моста
+func (d *DiscordPlatform) SetCommandHandler(handler CommandHandler) {
+	d.commands = handler
+}
+
+func (d *DiscordPlatform) Name() string {
+	return PlatformDiscord
+}
+
+func (d *DiscordPlatform) Messages() <-chan *Message {
+	return d.messages
+}
+
+// Обработчик сообщений Discord
+func (d *DiscordPlatform) onMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
+	log.Println("Discord message handler triggered.")
+	if m.Author.ID == s.State.User.ID || d.isOwnWebhook(m.WebhookID) {
+		return
+	}
+
+	// Логирование полученного сообщения
+	log.Printf("Received message: %s from %s", m.Content, m.Author.Username)
+
+	if d.commands != nil && d.commands(s, m) {
+		return
+	}
+
+	d.messages <- d.normalize(m.Message, MessageCreated)
+}
+
+// Обработчик редактирования сообщений Discord
+func (d *DiscordPlatform) onMessageUpdate(s *discordgo.Session, m *discordgo.MessageUpdate) {
+	// Обновления без автора приходят при подгрузке превью ссылок, текст в них не меняется
+	if m.Author == nil || m.Author.ID == s.State.User.ID || d.isOwnWebhook(m.WebhookID) {
+		return
+	}
+
+	log.Printf("Message %s edited by %s", m.ID, m.Author.Username)
+	d.messages <- d.normalize(m.Message, MessageEdited)
+}
+
+// Обработчик удаления сообщений Discord
+func (d *DiscordPlatform) onMessageDelete(s *discordgo.Session, m *discordgo.MessageDelete) {
+	chatID, threadID, _ := d.locate(m.ChannelID)
+	d.messages <- &Message{Kind: MessageDeleted, Platform: PlatformDiscord, ChatID: chatID, ID: m.ID, ThreadID: threadID}
+}
+
+// Обработчик массового удаления сообщений Discord
+func (d *DiscordPlatform) onMessageDeleteBulk(s *discordgo.Session, m *discordgo.MessageDeleteBulk) {
+	chatID, threadID, _ := d.locate(m.ChannelID)
+	for _, id := range m.Messages {
+		d.messages <- &Message{Kind: MessageDeleted, Platform: PlatformDiscord, ChatID: chatID, ID: id, ThreadID: threadID}
+	}
+}
+
+// Обработчик добавления реакции в Discord
+func (d *DiscordPlatform) onReactionAdd(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	if msg := d.normalizeReaction(s, r.MessageReaction); msg != nil {
+		msg.ReactionsAdded = []string{normalizeEmoji(r.Emoji.Name)}
+		d.messages <- msg
+	}
+}
+
+// Обработчик снятия реакции в Discord
+func (d *DiscordPlatform) onReactionRemove(s *discordgo.Session, r *discordgo.MessageReactionRemove) {
+	if msg := d.normalizeReaction(s, r.MessageReaction); msg != nil {
+		msg.ReactionsRemoved = []string{normalizeEmoji(r.Emoji.Name)}
+		d.messages <- msg
+	}
+}
+
+// normalizeReaction преобразует реакцию в сообщение MessageReacted. Реакции
+// бота и собственные эмодзи сервера, которых нет в Telegram, пропускаются
+func (d *DiscordPlatform) normalizeReaction(s *discordgo.Session, r *discordgo.MessageReaction) *Message {
+	if r.UserID == s.State.User.ID || r.Emoji.ID != "" || r.Emoji.Name == "" {
+		return nil
+	}
+	chatID, threadID, _ := d.locate(r.ChannelID)
+	return &Message{
+		Kind:     MessageReacted,
+		Platform: PlatformDiscord,
+		ChatID:   chatID,
+		ID:       r.MessageID,
+		Sender:   Sender{ID: r.UserID},
+		ThreadID: threadID,
+	}
+}
+
+// locate определяет, где находится канал. Ветки и посты форума Discord
+// являются отдельными каналами, поэтому для них возвращается родительский
+// канал, а также ID и название самой ветки
+func (d *DiscordPlatform) locate(channelID string) (chatID, threadID, threadName string) {
+	channel, err := d.channel(channelID)
+	if err != nil {
+		log.Printf("Failed to get Discord channel %s: %v", channelID, err)
+		return channelID, "", ""
+	}
+	if !channel.IsThread() {
+		return channelID, "", ""
+	}
+	return channel.ParentID, channel.ID, channel.Name
+}
+
+// channel возвращает канал из кэша или запрашивает его у Discord
+func (d *DiscordPlatform) channel(channelID string) (*discordgo.Channel, error) {
+	channel, err := d.session.State.Channel(channelID)
+	if err == nil {
+		return channel, nil
+	}
+	channel, err = d.session.Channel(channelID)
+	if err != nil {
+		return nil, err
+	}
+	d.session.State.ChannelAdd(channel)
+	return channel, nil
+}
+
+// normalize преобразует сообщение Discord в нормализованное сообщение
+func (d *DiscordPlatform) normalize(m *discordgo.Message, kind int) *Message {
+	chatID, threadID, threadName := d.locate(m.ChannelID)
+	msg := &Message{
+		Kind:       kind,
+		Platform:   PlatformDiscord,
+		ChatID:     chatID,
+		ID:         m.ID,
+		ThreadID:   threadID,
+		ThreadName: threadName,
+		Sender: Sender{
+			ID:       m.Author.ID,
+			Username: m.Author.Username,
+			Name:     m.Author.Username,
+		},
+	}
+	if m.Member != nil {
+		msg.Sender.Roles = m.Member.Roles
+	}
+	msg.Text, msg.Entities = parseDiscordMarkdown(m.Content, d.mentionResolver(m))
+	if ref := m.MessageReference; ref != nil && ref.ChannelID == m.ChannelID {
+		msg.ReplyTo = &ReplyInfo{ID: ref.MessageID}
+		if parent := m.ReferencedMessage; parent != nil {
+			msg.ReplyTo.Text, _ = parseDiscordMarkdown(parent.Content, d.mentionResolver(parent))
+			if parent.Author != nil {
+				msg.ReplyTo.Sender = Sender{ID: parent.Author.ID, Username: parent.Author.Username, Name: parent.Author.Username}
+			}
+		}
+	}
+	for _, attachment := range m.Attachments {
+		msg.Attachments = append(msg.Attachments, &Attachment{
+			Name:        attachment.Filename,
+			URL:         attachment.URL,
+			ContentType: attachment.ContentType,
+			Size:        attachment.Size,
+			Voice:       m.Flags&discordVoiceMessageFlag != 0,
+		})
+	}
+	if kind == MessageCreated {
+		addEmojiImages(msg, m.Content)
+	}
+	addStickers(msg, m.StickerItems)
+	addEmbeds(msg, m.Embeds, d.mentionResolver(m))
+	return msg
+}
+
+// mentionResolver заменяет упоминания в сообщении на имена участников, ролей и каналов
+func (d *DiscordPlatform) mentionResolver(m *discordgo.Message) MentionResolver {
+	return func(kind, id string) string {
+		switch kind {
+		case "#":
+			if channel, err := d.session.State.Channel(id); err == nil {
+				return "#" + channel.Name
+			}
+			return "#канал"
+		case "@&":
+			if role, err := d.session.State.Role(m.GuildID, id); err == nil {
+				return "@" + role.Name
+			}
+			return "@роль"
+		default:
+			return "@" + d.memberName(m, id)
+		}
+	}
+}
+
+// memberName отображаемое имя участника сервера: ник на сервере или имя пользователя
+func (d *DiscordPlatform) memberName(m *discordgo.Message, userID string) string {
+	if name := d.guildMemberName(m.GuildID, userID); name != "" {
+		return name
+	}
+
+	for _, user := range m.Mentions {
+		if user.ID == userID {
+			return user.Username
+		}
+	}
+	return userID
+}
+
+// guildMemberName имя участника сервера: ник или имя пользователя. Пустая
+// строка, если участник не найден
+func (d *DiscordPlatform) guildMemberName(guildID, userID string) string {
+	member, err := d.session.State.Member(guildID, userID)
+	if err != nil && guildID != "" {
+		member, err = d.session.GuildMember(guildID, userID)
+		if err == nil {
+			d.session.State.MemberAdd(member)
+		}
+	}
+	if err != nil {
+		return ""
+	}
+	if member.Nick != "" {
+		return member.Nick
+	}
+	return member.User.Username
+}
+
+// DisplayName отображаемое имя пользователя Discord для другой платформы:
+// ник на сервере канала channelID, имя пользователя или, если пользователь
+// не найден, его ID
+func (d *DiscordPlatform) DisplayName(channelID, userID string) string {
+	if channel, err := d.session.State.Channel(channelID); err == nil {
+		if name := d.guildMemberName(channel.GuildID, userID); name != "" {
+			return name
+		}
+	}
+	if user, err := d.ResolveUser(userID); err == nil {
+		return user.Username
+	}
+	return userID
+}
+
+// Бот упоминает только пользователей: @everyone, @here и роли из другой платформы не срабатывают
+var discordAllowedMentions = &discordgo.MessageAllowedMentions{
+	Parse: []discordgo.AllowedMentionType{discordgo.AllowedMentionTypeUsers},
+}
+
+// SendText отправка текстового сообщения в канал Discord
+func (d *DiscordPlatform) SendText(chatID, text string, opts SendOptions) (string, error) {
+	if opts.Username != "" {
+		msg, err := d.executeWebhook(chatID, opts.ThreadID, &discordgo.WebhookParams{
+			Content:         text,
+			Username:        webhookUsername(opts.Username),
+			AvatarURL:       opts.AvatarURL,
+			Embeds:          discordEmbeds(opts.Embeds),
+			AllowedMentions: discordAllowedMentions,
+		})
+		if err != nil {
+			return "", err
+		}
+		return msg.ID, nil
+	}
+
+	channelID := channelOf(chatID, opts)
+	msg, err := d.session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content:         text,
+		Embeds:          discordEmbeds(opts.Embeds),
+		Reference:       messageReference(channelID, opts),
+		AllowedMentions: discordAllowedMentions,
+	})
+	if err != nil {
+		return "", err
+	}
+	return msg.ID, nil
+}
+
+// Максимальное число файлов в одном сообщении Discord
+const discordMaxFiles = 10
+
+// SendFiles отправляет вложения в канал Discord одним сообщением вместе с подписью.
+// Если файлов больше discordMaxFiles, они разбиваются на несколько сообщений.
+// Голосовые сообщения отправляются каждое отдельно после остальных вложений
+func (d *DiscordPlatform) SendFiles(chatID string, files []*Attachment, caption string, opts SendOptions) ([]string, error) {
+	var voices, others []*Attachment
+	for _, file := range files {
+		if file.Voice {
+			voices = append(voices, file)
+		} else {
+			others = append(others, file)
+		}
+	}
+
+	var ids []string
+	// Голосовое сообщение не может содержать текст, поэтому подпись к одним
+	// голосовым сообщениям отправляется перед ними отдельно
+	if len(others) == 0 && caption != "" {
+		id, err := d.SendText(chatID, caption, opts)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+		caption = ""
+		opts = SendOptions{ThreadID: opts.ThreadID}
+	}
+
+	for start := 0; start < len(others); start += discordMaxFiles {
+		end := start + discordMaxFiles
+		if end > len(others) {
+			end = len(others)
+		}
+
+		msg, err := d.sendFiles(chatID, others[start:end], caption, opts)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, msg.ID)
+
+		// Подпись и ответ относятся только к первому сообщению
+		caption = ""
+		opts = SendOptions{ThreadID: opts.ThreadID}
+	}
+
+	for _, voice := range voices {
+		msg, err := d.sendVoice(channelOf(chatID, opts), voice)
+		if err != nil {
+			log.Printf("Failed to send %s as Discord voice message, sending as file: %v", voice.Name, err)
+			msg, err = d.sendFiles(chatID, []*Attachment{voice}, caption, opts)
+		}
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, msg.ID)
+	}
+	return ids, nil
+}
+
+// Флаг голосового сообщения, которого нет в discordgo
+const discordVoiceMessageFlag discordgo.MessageFlags = 1 << 13
+
+// Имя файла, под которым клиенты Discord показывают голосовые сообщения
+const discordVoiceFileName = "voice-message.ogg"
+
+// Структура для вложения голосового сообщения в запросе Discord
+type discordVoiceAttachment struct {
+	ID           string  `json:"id"`
+	Filename     string  `json:"filename"`
+	DurationSecs float64 `json:"duration_secs"`
+	Waveform     string  `json:"waveform"` // base64, значения громкости 0-255
+}
+
+// sendVoice отправляет файл Ogg/Opus голосовым сообщением с плеером и формой
+// волны. discordgo не умеет передавать длительность и форму волны, поэтому
+// запрос собирается вручную. Вебхуки не могут отправлять голосовые
+// сообщения, поэтому оно всегда отправляется от имени бота
+func (d *DiscordPlatform) sendVoice(channelID string, file *Attachment) (*discordgo.Message, error) {
+	reader, err := openAttachment(file, d.uploadLimit(channelID))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download: %v", err)
+	}
+
+	duration, waveform, err := oggVoiceInfo(data)
+	if err != nil {
+		return nil, err
+	}
+	payload := struct {
+		Flags       discordgo.MessageFlags   `json:"flags"`
+		Attachments []discordVoiceAttachment `json:"attachments"`
+	}{
+		Flags: discordVoiceMessageFlag,
+		Attachments: []discordVoiceAttachment{{
+			ID:           "0",
+			Filename:     discordVoiceFileName,
+			DurationSecs: duration,
+			Waveform:     base64.StdEncoding.EncodeToString(waveform),
+		}},
+	}
+	contentType, body, err := discordgo.MultipartBodyWithJSON(payload, []*discordgo.File{
+		{Name: discordVoiceFileName, ContentType: "audio/ogg", Reader: bytes.NewReader(data)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := discordgo.EndpointChannelMessages(channelID)
+	response, err := d.session.RequestWithLockedBucket("POST", endpoint, contentType, body, d.session.Ratelimiter.LockBucket(endpoint), 0)
+	if err != nil {
+		return nil, err
+	}
+	var msg discordgo.Message
+	if err := json.Unmarshal(response, &msg); err != nil {
+		return nil, fmt.Errorf("failed to decode sent message: %v", err)
+	}
+	return &msg, nil
+}
+
+// Ограничения Discord на размер вложений
+const (
+	discordUploadLimit      = 10 << 20  // максимальный размер загружаемого файла на обычном сервере
+	discordTier2UploadLimit = 50 << 20  // на сервере с бустом второго уровня
+	discordTier3UploadLimit = 100 << 20 // на сервере с бустом третьего уровня
+	discordStreamLimit      = 8 << 20   // более крупные файлы сначала сохраняются на диск
+)
+
+// uploadLimit максимальный размер файла, который бот может загрузить в канал.
+// Он зависит от уровня буста сервера
+func (d *DiscordPlatform) uploadLimit(chatID string) int64 {
+	channel, err := d.channel(chatID)
+	if err != nil {
+		return discordUploadLimit
+	}
+	guild, err := d.session.State.Guild(channel.GuildID)
+	if err != nil {
+		return discordUploadLimit
+	}
+	switch guild.PremiumTier {
+	case discordgo.PremiumTier2:
+		return discordTier2UploadLimit
+	case discordgo.PremiumTier3:
+		return discordTier3UploadLimit
+	}
+	return discordUploadLimit
+}
+
+// sendFiles отправляет вложения одним сообщением, передавая их содержимое
+// из источника напрямую в запрос Discord. Вложения, которые не удалось
+// скачать или которые превышают ограничение сервера, пропускаются
+func (d *DiscordPlatform) sendFiles(chatID string, files []*Attachment, caption string, opts SendOptions) (*discordgo.Message, error) {
+	limit := d.uploadLimit(chatID)
+	var discordFiles []*discordgo.File
+	for _, file := range files {
+		if int64(file.Size) > limit {
+			log.Printf("Skipping file %s: %d bytes exceeds Discord upload limit", file.Name, file.Size)
+			continue
+		}
+
+		reader, err := openAttachment(file, limit)
+		if err != nil {
+			log.Printf("Skipping file %s: %v", file.Name, err)
+			continue
+		}
+		defer reader.Close()
+
+		name := file.Name
+		if file.Spoiler {
+			// Discord скрывает под спойлер файлы с таким префиксом
+			name = "SPOILER_" + name
+		}
+		discordFiles = append(discordFiles, &discordgo.File{Name: name, ContentType: file.ContentType, Reader: reader})
+	}
+	if len(discordFiles) == 0 && caption == "" {
+		return nil, fmt.Errorf("no files to send")
+	}
+
+	if opts.Username != "" {
+		msg, err := d.executeWebhook(chatID, opts.ThreadID, &discordgo.WebhookParams{
+			Content:         caption,
+			Username:        webhookUsername(opts.Username),
+			AvatarURL:       opts.AvatarURL,
+			Files:           discordFiles,
+			Embeds:          discordEmbeds(opts.Embeds),
+			AllowedMentions: discordAllowedMentions,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to send files to Discord: %w", err)
+		}
+		return msg, nil
+	}
+
+	channelID := channelOf(chatID, opts)
+	msg, err := d.session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content:         caption,
+		Files:           discordFiles,
+		Embeds:          discordEmbeds(opts.Embeds),
+		Reference:       messageReference(channelID, opts),
+		AllowedMentions: discordAllowedMentions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send files to Discord: %w", err)
+	}
+	return msg, nil
+}
+
+// openAttachment открывает содержимое вложения для загрузки в Discord.
+// Небольшие файлы читаются прямо из ответа сервера, крупные и файлы
+// неизвестного размера сохраняются во временный файл, который удаляется при закрытии.
+// Файлы больше limit не скачиваются
+func openAttachment(file *Attachment, limit int64) (io.ReadCloser, error) {
+	resp, err := http.Get(file.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to download: %s", resp.Status)
+	}
+
+	size := int64(file.Size)
+	if size == 0 {
+		size = resp.ContentLength
+	}
+	if size > limit {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%d bytes exceeds Discord upload limit", size)
+	}
+	if size >= 0 && size <= discordStreamLimit {
+		return resp.Body, nil
+	}
+
+	defer resp.Body.Close()
+	return spillToDisk(resp.Body, limit)
+}
+
+// Структура для временного файла, который удаляется при закрытии
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	if removeErr := os.Remove(f.Name()); removeErr != nil {
+		log.Printf("Failed to remove file %s: %v", f.Name(), removeErr)
+	}
+	return err
+}
+
+// spillToDisk сохраняет поток во временный файл, прерываясь, если он больше limit
+func spillToDisk(reader io.Reader, limit int64) (io.ReadCloser, error) {
+	file, err := os.CreateTemp("", "bridge-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %v", err)
+	}
+	spilled := &tempFile{file}
+
+	written, err := io.Copy(file, io.LimitReader(reader, limit+1))
+	if err == nil && written > limit {
+		err = fmt.Errorf("file exceeds %d bytes", limit)
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		spilled.Close()
+		return nil, err
+	}
+	return spilled, nil
+}
+
+// channelOf канал, в который отправляется сообщение: ветка, если она указана
+func channelOf(chatID string, opts SendOptions) string {
+	if opts.ThreadID != "" {
+		return opts.ThreadID
+	}
+	return chatID
+}
+
+// messageReference ссылка на сообщение, ответом на которое отправляется новое
+func messageReference(chatID string, opts SendOptions) *discordgo.MessageReference {
+	if opts.ReplyTo == "" {
+		return nil
+	}
+	return &discordgo.MessageReference{MessageID: opts.ReplyTo, ChannelID: chatID}
+}
+
+// discordEmbeds преобразует встраиваемые блоки в формат Discord
+func discordEmbeds(embeds []*Embed) []*discordgo.MessageEmbed {
+	var result []*discordgo.MessageEmbed
+	for _, embed := range embeds {
+		discordEmbed := &discordgo.MessageEmbed{
+			Title:       embed.Title,
+			Description: embed.Description,
+			URL:         embed.URL,
+		}
+		for _, field := range embed.Fields {
+			discordEmbed.Fields = append(discordEmbed.Fields, &discordgo.MessageEmbedField{
+				Name:   field.Name,
+				Value:  field.Value,
+				Inline: field.Inline,
+			})
+		}
+		if embed.Footer != "" {
+			discordEmbed.Footer = &discordgo.MessageEmbedFooter{Text: embed.Footer}
+		}
+		if embed.ImageURL != "" {
+			discordEmbed.Image = &discordgo.MessageEmbedImage{URL: embed.ImageURL}
+		}
+		if embed.ThumbnailURL != "" {
+			discordEmbed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: embed.ThumbnailURL}
+		}
+		result = append(result, discordEmbed)
+	}
+	return result
+}
+
+// EditText редактирование текста сообщения в канале или ветке Discord.
+// Сообщения, отправленные через вебхук моста, редактируются через вебхук
+func (d *DiscordPlatform) EditText(chatID, messageID, text string) error {
+	_, err := d.session.ChannelMessageEdit(chatID, messageID, text)
+	if err == nil {
+		return nil
+	}
+
+	webhook, options := d.webhookOf(chatID)
+	if webhook == nil {
+		return err
+	}
+	_, err = d.session.WebhookMessageEdit(webhook.ID, webhook.Token, messageID, &discordgo.WebhookEdit{Content: &text}, options...)
+	return err
+}
+
+// EditCaption в Discord подпись вложения является текстом сообщения
+func (d *DiscordPlatform) EditCaption(chatID, messageID, caption string) error {
+	return d.EditText(chatID, messageID, caption)
+}
+
+// DeleteMessage удаление сообщения из канала Discord. Без права на управление
+// сообщениями бот может удалить сообщение вебхука моста только через вебхук
+func (d *DiscordPlatform) DeleteMessage(chatID, messageID string) error {
+	err := d.session.ChannelMessageDelete(chatID, messageID)
+	if err == nil {
+		return nil
+	}
+
+	webhook, options := d.webhookOf(chatID)
+	if webhook == nil {
+		return err
+	}
+	return d.session.WebhookMessageDelete(webhook.ID, webhook.Token, messageID, options...)
+}
+
+// webhookOf вебхук моста, через который отправлены сообщения в канал или
+// ветку, и параметры запроса для сообщений ветки. nil, если вебхука нет
+func (d *DiscordPlatform) webhookOf(channelID string) (*discordgo.Webhook, []discordgo.RequestOption) {
+	parentID, threadID, _ := d.locate(channelID)
+	webhook, err := d.webhook(parentID, false)
+	if err != nil || webhook == nil {
+		return nil, nil
+	}
+	if threadID == "" {
+		return webhook, nil
+	}
+	return webhook, []discordgo.RequestOption{withThreadID(threadID)}
+}
+
+// withThreadID указывает ветку в запросе к сообщению вебхука, без этого
+// Discord ищет сообщение только в родительском канале
+func withThreadID(threadID string) discordgo.RequestOption {
+	return func(cfg *discordgo.RequestConfig) {
+		query := cfg.Request.URL.Query()
+		query.Set("thread_id", threadID)
+		cfg.Request.URL.RawQuery = query.Encode()
+	}
+}
+
+// SetReactions приводит реакции бота на сообщение к списку emojis
+func (d *DiscordPlatform) SetReactions(chatID, messageID string, emojis []string) error {
+	msg, err := d.session.ChannelMessage(chatID, messageID)
+	if err != nil {
+		return err
+	}
+
+	var current []string
+	for _, reaction := range msg.Reactions {
+		if reaction.Me && reaction.Emoji.ID == "" {
+			current = append(current, normalizeEmoji(reaction.Emoji.Name))
+		}
+	}
+
+	for _, emoji := range diffReactions(current, emojis) {
+		if err := d.session.MessageReactionRemove(chatID, messageID, discordReactionEmoji(emoji), "@me"); err != nil {
+			return err
+		}
+	}
+	for _, emoji := range diffReactions(emojis, current) {
+		if err := d.session.MessageReactionAdd(chatID, messageID, discordReactionEmoji(emoji)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolveUser получение пользователя Discord по ID
+func (d *DiscordPlatform) ResolveUser(userID string) (*Sender, error) {
+	user, err := d.session.User(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &Sender{ID: user.ID, Username: user.Username, Name: user.Username, AvatarURL: user.AvatarURL("")}, nil
+}
+
+// Ограничения Discord для веток
+const (
+	discordThreadNameLimit       = 100  // длина названия
+	discordThreadArchiveDuration = 1440 // минут без сообщений до архивации
+)
+
+// CreateThread создаёт ветку в текстовом канале или пост в канале-форуме.
+// Пост форума не может быть пустым, поэтому его первым сообщением становится название
+func (d *DiscordPlatform) CreateThread(chatID, name string) (string, error) {
+	runes := []rune(name)
+	if len(runes) > discordThreadNameLimit {
+		name = string(runes[:discordThreadNameLimit])
+	}
+
+	channel, err := d.channel(chatID)
+	if err != nil {
+		return "", err
+	}
+
+	var thread *discordgo.Channel
+	if channel.Type == discordgo.ChannelTypeGuildForum {
+		thread, err = d.session.ForumThreadStart(chatID, name, discordThreadArchiveDuration, name)
+	} else {
+		thread, err = d.session.ThreadStart(chatID, name, discordgo.ChannelTypeGuildPublicThread, discordThreadArchiveDuration)
+	}
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Created Discord thread %s (%s) in channel %s", thread.ID, name, chatID)
+	return thread.ID, nil
+}
+
+// FileURL ссылка на вложение Discord. Ссылки CDN не содержат секретов,
+// поэтому сохраняются во вложении как есть
+func (d *DiscordPlatform) FileURL(file *Attachment) (string, error) {
+	return file.URL, nil
+}
+
+// executeWebhook отправляет сообщение через вебхук моста, создавая его при
+// необходимости. У веток нет своих вебхуков, в них пишет вебхук канала
+func (d *DiscordPlatform) executeWebhook(chatID, threadID string, params *discordgo.WebhookParams) (*discordgo.Message, error) {
+	webhook, err := d.webhook(chatID, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook for channel %s: %w", chatID, err)
+	}
+	if threadID != "" {
+		return d.session.WebhookThreadExecute(webhook.ID, webhook.Token, true, threadID, params)
+	}
+	return d.session.WebhookExecute(webhook.ID, webhook.Token, true, params)
+}
+
+// webhook возвращает вебхук моста в канале. Если вебхука нет, он создаётся
+// при create, иначе возвращается nil
+func (d *DiscordPlatform) webhook(channelID string, create bool) (*discordgo.Webhook, error) {
+	d.webhooksMu.Lock()
+	defer d.webhooksMu.Unlock()
+
+	if webhook, exists := d.webhooks[channelID]; exists && (webhook != nil || !create) {
+		return webhook, nil
+	}
+
+	webhooks, err := d.session.ChannelWebhooks(channelID)
+	if err != nil {
+		return nil, err
+	}
+	for _, webhook := range webhooks {
+		// Токен есть только у вебхуков, созданных самим ботом
+		if webhook.Name == bridgeWebhookName && webhook.Token != "" {
+			d.webhooks[channelID] = webhook
+			return webhook, nil
+		}
+	}
+
+	if !create {
+		d.webhooks[channelID] = nil
+		return nil, nil
+	}
+	webhook, err := d.session.WebhookCreate(channelID, bridgeWebhookName, "")
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Created bridge webhook %s in channel %s", webhook.ID, channelID)
+	d.webhooks[channelID] = webhook
+	return webhook, nil
+}
+
+// isOwnWebhook отправлено ли сообщение через вебхук моста
+func (d *DiscordPlatform) isOwnWebhook(webhookID string) bool {
+	if webhookID == "" {
+		return false
+	}
+
+	d.webhooksMu.Lock()
+	defer d.webhooksMu.Unlock()
+	for _, webhook := range d.webhooks {
+		if webhook != nil && webhook.ID == webhookID {
+			return true
+		}
+	}
+	return false
+}
+
+// Максимальная длина имени отправителя вебхука
+const webhookUsernameLimit = 80
+
+// Слова, которые Discord запрещает в именах вебхуков
+var webhookForbiddenWords = regexp.MustCompile(`(?i)discord|clyde`)
+
+// webhookUsername приводит имя к ограничениям Discord: не длиннее 80 символов
+// и без запрещённых слов, которые разбиваются пробелом нулевой ширины
+func webhookUsername(name string) string {
+	name = webhookForbiddenWords.ReplaceAllStringFunc(name, func(word string) string {
+		return word[:1] + "\u200b" + word[1:]
+	})
+
+	runes := []rune(name)
+	if len(runes) > webhookUsernameLimit {
+		runes = runes[:webhookUsernameLimit]
+	}
+	return string(runes)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Сколько собственных эмодзи может быть в сообщении, чтобы они пересылались изображениями
+const emojiImageLimit = 3
+
+// addEmojiImages пересылает сообщение, состоящее только из собственных эмодзи,
+// их изображениями, как Discord показывает такие сообщения крупно
+func addEmojiImages(msg *Message, content string) {
+	emojis := discordEmoji.FindAllStringSubmatch(content, -1)
+	if len(emojis) == 0 || len(emojis) > emojiImageLimit {
+		return
+	}
+	if strings.TrimSpace(discordEmoji.ReplaceAllString(content, "")) != "" {
+		return
+	}
+
+	for _, emoji := range emojis {
+		ext, contentType := "png", "image/png"
+		if emoji[1] == "a" {
+			ext, contentType = "gif", "image/gif"
+		}
+		msg.Attachments = append(msg.Attachments, &Attachment{
+			Name:        fmt.Sprintf("%s.%s", emoji[2], ext),
+			URL:         fmt.Sprintf("https://cdn.discordapp.com/emojis/%s.%s", emoji[3], ext),
+			ContentType: contentType,
+		})
+	}
+	msg.Text = ""
+	msg.Entities = nil
+}
+
+// addStickers добавляет стикеры Discord как изображения. Стикеры Lottie
+// в Telegram не показать, вместо них пересылается их название
+func addStickers(msg *Message, stickers []*discordgo.Sticker) {
+	for _, sticker := range stickers {
+		ext, contentType := "png", "image/png"
+		switch sticker.FormatType {
+		case discordgo.StickerFormatTypeGIF:
+			ext, contentType = "gif", "image/gif"
+		case discordgo.StickerFormatTypeLottie:
+			if msg.Text != "" {
+				msg.Text += "\n"
+			}
+			msg.Text += fmt.Sprintf("[стикер: %s]", sticker.Name)
+			continue
+		}
+		msg.Attachments = append(msg.Attachments, &Attachment{
+			Name:        fmt.Sprintf("%s.%s", sticker.Name, ext),
+			URL:         fmt.Sprintf("https://media.discordapp.net/stickers/%s.%s", sticker.ID, ext),
+			ContentType: contentType,
+		})
+	}
+}
+
+// addEmbeds добавляет к тексту сообщения встраиваемые блоки Discord (превью
+// ссылок и сообщения ботов): заголовок, описание, поля и подпись блока с
+// форматированием. Изображение блока или его миниатюра пересылается вложением
+func addEmbeds(msg *Message, embeds []*discordgo.MessageEmbed, resolve MentionResolver) {
+	text, entities := msg.Text, msg.Entities
+	// add дописывает текст с форматированием formats на всю его длину
+	add := func(s string, formats ...Entity) {
+		for _, format := range formats {
+			format.Offset, format.Length = utf16Len(text), utf16Len(s)
+			entities = append(entities, format)
+		}
+		text += s
+	}
+	// addMarkdown дописывает текст в разметке Discord
+	addMarkdown := func(src string) {
+		plain, parsed := parseDiscordMarkdown(src, resolve)
+		offset := utf16Len(text)
+		for _, entity := range parsed {
+			entity.Offset += offset
+			entities = append(entities, entity)
+		}
+		text += plain
+	}
+
+	for _, embed := range embeds {
+		if image := embedImage(embed); image != nil {
+			msg.Attachments = append(msg.Attachments, image)
+		}
+
+		// Блок отделяется от текста пустой строкой, строки блока переводом строки
+		lines := 0
+		line := func() {
+			switch {
+			case lines > 0:
+				text += "\n"
+			case text != "":
+				text += "\n\n"
+			}
+			lines++
+		}
+
+		if embed.Title != "" {
+			line()
+			if embed.URL != "" {
+				add(embed.Title, Entity{Type: EntityBold}, Entity{Type: EntityTextLink, URL: embed.URL})
+			} else {
+				add(embed.Title, Entity{Type: EntityBold})
+			}
+		}
+		if embed.Description != "" {
+			line()
+			addMarkdown(embed.Description)
+		}
+		for _, field := range embed.Fields {
+			line()
+			add(field.Name+":", Entity{Type: EntityBold})
+			text += " "
+			addMarkdown(field.Value)
+		}
+		if embed.Footer != nil && embed.Footer.Text != "" {
+			line()
+			add(embed.Footer.Text, Entity{Type: EntityItalic})
+		}
+	}
+	msg.Text, msg.Entities = text, entities
+}
+
+// embedImage изображение встраиваемого блока или, если его нет, миниатюра.
+// Берётся копия из кэша Discord: исходный сервер может быть недоступен для Telegram
+func embedImage(embed *discordgo.MessageEmbed) *Attachment {
+	var link string
+	switch {
+	case embed.Image != nil:
+		link = embed.Image.ProxyURL
+		if link == "" {
+			link = embed.Image.URL
+		}
+	case embed.Thumbnail != nil:
+		link = embed.Thumbnail.ProxyURL
+		if link == "" {
+			link = embed.Thumbnail.URL
+		}
+	}
+	parsed, err := url.Parse(link)
+	if link == "" || err != nil {
+		return nil
+	}
+
+	ext := path.Ext(parsed.Path)
+	contentType := mime.TypeByExtension(ext)
+	if !strings.HasPrefix(contentType, "image/") {
+		// Адреса изображений часто без расширения, а Telegram сам определит формат фото
+		ext, contentType = ".jpg", "image/jpeg"
+	}
+	return &Attachment{Name: "embed" + ext, URL: link, ContentType: contentType}
+}
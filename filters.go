@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Действия с вложениями сообщений, проходящих через фильтры
+const (
+	AttachmentsKeep    = ""        // пересылать как есть
+	AttachmentsDrop    = "drop"    // не пересылать
+	AttachmentsSpoiler = "spoiler" // пересылать под спойлером
+)
+
+// Как часто проверять, изменился ли файл фильтров
+const filtersReloadInterval = 5 * time.Second
+
+// Структура для настроек фильтров моста
+type FilterConfig struct {
+	// Регулярные выражения: сообщения с совпадающим текстом не пересылаются
+	Blocklist []string `json:"blocklist"`
+	// Сообщения, начинающиеся с этого префикса, не пересылаются, например "//"
+	SkipPrefix string `json:"skip_prefix"`
+	// Пользователи Discord и роли Discord, чьи сообщения не пересылаются
+	DiscordUsers []string `json:"discord_users"`
+	DiscordRoles []string `json:"discord_roles"`
+	// Пользователи и чаты Telegram, чьи сообщения не пересылаются
+	TelegramUsers []string `json:"telegram_users"`
+	// Что делать с вложениями: "" (пересылать), "drop" или "spoiler"
+	Attachments string `json:"attachments"`
+}
+
+// Структура для фильтров моста, которые перечитываются из файла при его изменении
+type Filters struct {
+	mu        sync.RWMutex
+	filepath  string
+	modTime   time.Time
+	config    FilterConfig
+	blocklist []*regexp.Regexp
+}
+
+// Создание фильтров из файла. Если файла нет, сообщения не фильтруются
+func NewFilters(filepath string) *Filters {
+	return &Filters{filepath: filepath}
+}
+
+// Загрузка фильтров из файла. При ошибке остаются прежние фильтры
+func (f *Filters) LoadFromFile() error {
+	info, err := os.Stat(f.filepath)
+	if os.IsNotExist(err) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if !f.modTime.IsZero() {
+			log.Printf("File %s was removed. Bridge filters are disabled.", f.filepath)
+		}
+		f.config, f.blocklist, f.modTime = FilterConfig{}, nil, time.Time{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %v", err)
+	}
+
+	f.mu.RLock()
+	unchanged := info.ModTime().Equal(f.modTime)
+	f.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	config, blocklist, err := readFilters(f.filepath)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// Ошибочный файл не перечитывается, пока его не изменят снова
+	f.modTime = info.ModTime()
+	if err != nil {
+		return err
+	}
+	f.config, f.blocklist = config, blocklist
+	log.Printf("Loaded bridge filters from %s: %d blocklist patterns", f.filepath, len(blocklist))
+	return nil
+}
+
+// readFilters читает и проверяет настройки фильтров
+func readFilters(filepath string) (FilterConfig, []*regexp.Regexp, error) {
+	var config FilterConfig
+	file, err := os.Open(filepath)
+	if err != nil {
+		return config, nil, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&config); err != nil {
+		return config, nil, fmt.Errorf("failed to decode filters: %v", err)
+	}
+	switch config.Attachments {
+	case AttachmentsKeep, AttachmentsDrop, AttachmentsSpoiler:
+	default:
+		return config, nil, fmt.Errorf("invalid attachments action %q", config.Attachments)
+	}
+	var blocklist []*regexp.Regexp
+	for _, pattern := range config.Blocklist {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return config, nil, fmt.Errorf("invalid blocklist pattern %q: %v", pattern, err)
+		}
+		blocklist = append(blocklist, re)
+	}
+	return config, blocklist, nil
+}
+
+// Функция для периодической проверки изменений файла фильтров
+func (f *Filters) PeriodicReload() {
+	ticker := time.NewTicker(filtersReloadInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := f.LoadFromFile(); err != nil {
+			log.Printf("Failed to reload bridge filters: %v", err)
+		}
+	}
+}
+
+// Apply пропускает сообщение через фильтры. Возвращает nil, если сообщение
+// не должно пересылаться, или сообщение с учётом правила для вложений.
+// Удаления и реакции не фильтруются
+func (f *Filters) Apply(msg *Message) *Message {
+	if msg.Kind != MessageCreated && msg.Kind != MessageEdited {
+		return msg
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	switch msg.Platform {
+	case PlatformDiscord:
+		if contains(f.config.DiscordUsers, msg.Sender.ID) {
+			return nil
+		}
+		for _, role := range msg.Sender.Roles {
+			if contains(f.config.DiscordRoles, role) {
+				return nil
+			}
+		}
+	case PlatformTelegram:
+		if contains(f.config.TelegramUsers, msg.Sender.ID) {
+			return nil
+		}
+	}
+
+	if f.config.SkipPrefix != "" && strings.HasPrefix(strings.TrimSpace(msg.Text), f.config.SkipPrefix) {
+		return nil
+	}
+	for _, re := range f.blocklist {
+		if re.MatchString(msg.Text) {
+			return nil
+		}
+	}
+
+	if len(msg.Attachments) == 0 || f.config.Attachments == AttachmentsKeep {
+		return msg
+	}
+	filtered := *msg
+	filtered.Attachments = nil
+	if f.config.Attachments == AttachmentsSpoiler {
+		for _, attachment := range msg.Attachments {
+			spoiler := *attachment
+			spoiler.Spoiler = true
+			filtered.Attachments = append(filtered.Attachments, &spoiler)
+		}
+	}
+	if filtered.Text == "" && len(filtered.Attachments) == 0 && len(filtered.Embeds) == 0 {
+		return nil
+	}
+	return &filtered
+}
+
+// contains есть ли значение в списке
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,498 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Типы форматирования текста
+const (
+	EntityBold          = "bold"
+	EntityItalic        = "italic"
+	EntityUnderline     = "underline"
+	EntityStrikethrough = "strikethrough"
+	EntitySpoiler       = "spoiler"
+	EntityCode          = "code"
+	EntityPre           = "pre"
+	EntityTextLink      = "text_link" // текст со ссылкой
+	EntityURL           = "url"       // ссылка в тексте как есть
+	EntityMention       = "mention"   // упоминание пользователя
+)
+
+// Структура для форматирования участка текста. Смещение и длина считаются
+// в кодовых единицах UTF-16, как в Telegram
+type Entity struct {
+	Type     string
+	Offset   int
+	Length   int
+	URL      string // для EntityTextLink
+	Language string // для EntityPre
+	UserID   string // для EntityMention: ID упомянутого пользователя, если он известен
+}
+
+// entityText возвращает участок текста, к которому относится форматирование
+func entityText(text string, entity Entity) string {
+	units := utf16.Encode([]rune(text))
+	if entity.Offset < 0 || entity.Length < 0 || entity.Offset+entity.Length > len(units) {
+		return ""
+	}
+	return string(utf16.Decode(units[entity.Offset : entity.Offset+entity.Length]))
+}
+
+// utf16Len длина строки в кодовых единицах UTF-16
+func utf16Len(s string) int {
+	length := 0
+	for _, r := range s {
+		length += utf16.RuneLen(r)
+	}
+	return length
+}
+
+// Парные маркеры Discord в порядке проверки: тройные раньше двойных, двойные
+// раньше одинарных. Тройной маркер открывает сразу два вида форматирования
+var discordMarkers = []struct {
+	marker   string
+	entities []string
+}{
+	{"***", []string{EntityBold, EntityItalic}},
+	{"___", []string{EntityUnderline, EntityItalic}},
+	{"**", []string{EntityBold}},
+	{"__", []string{EntityUnderline}},
+	{"~~", []string{EntityStrikethrough}},
+	{"||", []string{EntitySpoiler}},
+	{"*", []string{EntityItalic}},
+	{"_", []string{EntityItalic}},
+}
+
+// Ссылка с текстом в разметке Discord: [текст](https://...)
+var discordMaskedLink = regexp.MustCompile(`^\[([^\[\]]+)\]\(<?(https?://[^\s()<>]+)>?\)`)
+
+// Упоминание в разметке Discord: пользователь <@id>, роль <@&id> или канал <#id>
+var discordMention = regexp.MustCompile(`^<(@!?|@&|#)(\d+)>`)
+
+// Собственный эмодзи Discord: <:name:id> или анимированный <a:name:id>.
+// Ищется в любом месте текста
+var discordEmoji = regexp.MustCompile(`<(a?):(\w+):(\d+)>`)
+
+// Ссылка, которую Discord показывает ссылкой без разметки. Знаки препинания
+// в конце к ней не относятся
+var discordBareURL = regexp.MustCompile(`^https?://[^\s<]+[^\s<.,:;"')\]!?]`)
+
+// Ссылка в угловых скобках, для которой Discord не показывает превью
+var discordQuietURL = regexp.MustCompile(`^<(https?://[^\s<>]+)>`)
+
+// MentionResolver возвращает текст упоминания по его виду ("@", "@!", "@&", "#") и ID
+type MentionResolver func(kind, id string) string
+
+// Язык в первой строке блока кода
+var codeLanguage = regexp.MustCompile(`^[A-Za-z0-9_+#.-]+$`)
+
+// Структура для разбора разметки Discord в текст и форматирование
+type markdownParser struct {
+	text     strings.Builder
+	length   int
+	entities []Entity
+	resolve  MentionResolver
+}
+
+// parseDiscordMarkdown разбирает разметку Discord: возвращает текст без
+// маркеров и форматирование его участков. Упоминания заменяются текстом из resolve
+func parseDiscordMarkdown(src string, resolve MentionResolver) (string, []Entity) {
+	p := &markdownParser{resolve: resolve}
+	p.parse(src)
+	return p.text.String(), p.entities
+}
+
+func (p *markdownParser) write(s string) {
+	p.text.WriteString(s)
+	p.length += utf16Len(s)
+}
+
+// entity добавляет форматирование для текста, который записывает body
+func (p *markdownParser) entity(entity Entity, body func()) {
+	entity.Offset = p.length
+	body()
+	entity.Length = p.length - entity.Offset
+	if entity.Length > 0 {
+		p.entities = append(p.entities, entity)
+	}
+}
+
+func (p *markdownParser) parse(src string) {
+	for i := 0; i < len(src); {
+		if n := p.parseToken(src, i); n > 0 {
+			i += n
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(src[i:])
+		p.write(src[i : i+size])
+		i += size
+	}
+}
+
+// parseToken разбирает разметку в позиции i и возвращает длину разобранного
+// фрагмента или 0, если разметки в этой позиции нет
+func (p *markdownParser) parseToken(src string, i int) int {
+	rest := src[i:]
+
+	switch {
+	case rest[0] == '\\' && len(rest) > 1 && isMarkdownPunct(rest[1]):
+		p.write(rest[1:2])
+		return 2
+
+	case strings.HasPrefix(rest, "```"):
+		end := strings.Index(rest[3:], "```")
+		if end < 0 {
+			return 0
+		}
+		body := rest[3 : 3+end]
+		entity := Entity{Type: EntityPre}
+		if newline := strings.IndexByte(body, '\n'); newline >= 0 && codeLanguage.MatchString(body[:newline]) {
+			entity.Language = body[:newline]
+			body = body[newline+1:]
+		}
+		body = strings.TrimPrefix(strings.TrimSuffix(body, "\n"), "\n")
+		p.entity(entity, func() { p.write(body) })
+		return 3 + end + 3
+
+	case rest[0] == '`':
+		marker := "`"
+		if strings.HasPrefix(rest, "``") {
+			marker = "``"
+		}
+		end := strings.Index(rest[len(marker):], marker)
+		if end <= 0 {
+			return 0
+		}
+		body := rest[len(marker) : len(marker)+end]
+		p.entity(Entity{Type: EntityCode}, func() { p.write(body) })
+		return len(marker) + end + len(marker)
+
+	case strings.HasPrefix(rest, "<:") || strings.HasPrefix(rest, "<a:"):
+		match := discordEmoji.FindStringSubmatch(rest)
+		if match == nil || !strings.HasPrefix(rest, match[0]) {
+			return 0
+		}
+		p.write(":" + match[2] + ":")
+		return len(match[0])
+
+	case strings.HasPrefix(rest, "http://") || strings.HasPrefix(rest, "https://"):
+		// Разметка внутри ссылки не разбирается, иначе ссылка сломается
+		url := discordBareURL.FindString(rest)
+		if url == "" {
+			return 0
+		}
+		p.entity(Entity{Type: EntityURL}, func() { p.write(url) })
+		return len(url)
+
+	case strings.HasPrefix(rest, "<http"):
+		match := discordQuietURL.FindStringSubmatch(rest)
+		if match == nil {
+			return 0
+		}
+		p.entity(Entity{Type: EntityURL}, func() { p.write(match[1]) })
+		return len(match[0])
+
+	case rest[0] == '<' && p.resolve != nil:
+		match := discordMention.FindStringSubmatch(rest)
+		if match == nil {
+			return 0
+		}
+		text := p.resolve(match[1], match[2])
+		if match[1] == "@" || match[1] == "@!" {
+			p.entity(Entity{Type: EntityMention, UserID: match[2]}, func() { p.write(text) })
+		} else {
+			p.write(text)
+		}
+		return len(match[0])
+
+	case rest[0] == '[':
+		match := discordMaskedLink.FindStringSubmatch(rest)
+		if match == nil {
+			return 0
+		}
+		p.entity(Entity{Type: EntityTextLink, URL: match[2]}, func() { p.parse(match[1]) })
+		return len(match[0])
+	}
+
+	for _, m := range discordMarkers {
+		if !strings.HasPrefix(rest, m.marker) {
+			continue
+		}
+		// Подчёркивания внутри слов (snake_case) не являются разметкой
+		if m.marker == "_" && i > 0 && isWordByte(src[i-1]) {
+			return 0
+		}
+		end := closingMarker(rest[len(m.marker):], m.marker)
+		if end <= 0 {
+			continue
+		}
+		body := rest[len(m.marker) : len(m.marker)+end]
+		after := len(m.marker) + end + len(m.marker)
+		if len(m.marker) == 1 && (unicode.IsSpace(rune(body[0])) || m.marker == "_" && after < len(rest) && isWordByte(rest[after])) {
+			continue
+		}
+		// Форматирование вкладывается от первого вида к последнему
+		inner := func() { p.parse(body) }
+		for j := len(m.entities) - 1; j >= 0; j-- {
+			entity, body := Entity{Type: m.entities[j]}, inner
+			inner = func() { p.entity(entity, body) }
+		}
+		inner()
+		return after
+	}
+	return 0
+}
+
+// closingMarker ищет закрывающий маркер, пропуская экранированные символы,
+// а для одинарных маркеров и вложенные двойные
+func closingMarker(src, marker string) int {
+	for i := 0; i < len(src); i++ {
+		switch {
+		case src[i] == '\\':
+			i++
+		case len(marker) == 1 && strings.HasPrefix(src[i:], marker+marker):
+			i++
+		case strings.HasPrefix(src[i:], marker):
+			return i
+		}
+	}
+	return -1
+}
+
+// isMarkdownPunct можно ли экранировать символ обратной косой чертой
+func isMarkdownPunct(c byte) bool {
+	return strings.IndexByte("\\`*_~|[]()<>#-.!:", c) >= 0
+}
+
+// isWordByte является ли байт частью слова
+func isWordByte(c byte) bool {
+	return c >= utf8.RuneSelf || c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// Структура для правил вывода форматирования в разметку платформы
+type markup struct {
+	open   func(entity Entity) string
+	close  func(entity Entity) string
+	escape func(text string, raw bool) string // raw: внутри кода или ссылки
+	// raw определяет, выводится ли текст внутри форматирования как есть. Если nil, используется isRawEntity
+	raw func(entity Entity) bool
+	// replace заменяет участок текста целиком, если возвращает true. Может быть nil
+	replace func(entity Entity) (string, bool)
+}
+
+// isRawEntity не обрабатывается ли разметка внутри форматирования
+func isRawEntity(entity Entity) bool {
+	return entity.Type == EntityCode || entity.Type == EntityPre || entity.Type == EntityURL
+}
+
+// Порядок вложения форматирования одного и того же участка: меньший ранг снаружи
+var entityRank = map[string]int{
+	EntityTextLink:      0,
+	EntityUnderline:     1,
+	EntityBold:          2,
+	EntityItalic:        3,
+	EntityStrikethrough: 4,
+	EntitySpoiler:       5,
+	EntityCode:          6,
+	EntityPre:           6,
+	EntityURL:           6,
+	EntityMention:       6,
+}
+
+// renderEntities выводит текст с форматированием в разметке платформы.
+// Пересекающиеся участки обрезаются так, чтобы маркеры были вложены правильно
+func renderEntities(text string, entities []Entity, m markup) string {
+	sorted := make([]Entity, len(entities))
+	copy(sorted, entities)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Offset != sorted[j].Offset {
+			return sorted[i].Offset < sorted[j].Offset
+		}
+		if sorted[i].Length != sorted[j].Length {
+			return sorted[i].Length > sorted[j].Length
+		}
+		return entityRank[sorted[i].Type] < entityRank[sorted[j].Type]
+	})
+
+	isRaw := m.raw
+	if isRaw == nil {
+		isRaw = isRawEntity
+	}
+
+	var out strings.Builder
+	var stack []Entity
+	end := func(entity Entity) int { return entity.Offset + entity.Length }
+	closeUntil := func(pos int) {
+		for len(stack) > 0 && end(stack[len(stack)-1]) <= pos {
+			out.WriteString(m.close(stack[len(stack)-1]))
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	pos, next, skipUntil := 0, 0, 0
+	for _, r := range text {
+		if pos < skipUntil {
+			pos += utf16.RuneLen(r)
+			continue
+		}
+
+		closeUntil(pos)
+		for ; next < len(sorted) && sorted[next].Offset <= pos && pos >= skipUntil; next++ {
+			entity := sorted[next]
+			if len(stack) > 0 && end(entity) > end(stack[len(stack)-1]) {
+				entity.Length = end(stack[len(stack)-1]) - entity.Offset
+			}
+			if end(entity) <= pos {
+				continue
+			}
+			if m.replace != nil {
+				if replacement, ok := m.replace(entity); ok {
+					out.WriteString(replacement)
+					skipUntil = end(entity)
+					continue
+				}
+			}
+			out.WriteString(m.open(entity))
+			stack = append(stack, entity)
+		}
+		if pos < skipUntil {
+			pos += utf16.RuneLen(r)
+			continue
+		}
+
+		raw := false
+		for _, entity := range stack {
+			raw = raw || isRaw(entity)
+		}
+		out.WriteString(m.escape(string(r), raw))
+		pos += utf16.RuneLen(r)
+	}
+	for len(stack) > 0 {
+		out.WriteString(m.close(stack[len(stack)-1]))
+		stack = stack[:len(stack)-1]
+	}
+	return out.String()
+}
+
+// Маркеры разметки Discord
+var discordEntityMarkers = map[string]string{
+	EntityBold:          "**",
+	EntityItalic:        "*",
+	EntityUnderline:     "__",
+	EntityStrikethrough: "~~",
+	EntitySpoiler:       "||",
+	EntityCode:          "`",
+}
+
+// Маркеры MarkdownV2
+var markdownV2Markers = map[string]string{
+	EntityBold:          "*",
+	EntityItalic:        "_",
+	EntityUnderline:     "__",
+	EntityStrikethrough: "~",
+	EntitySpoiler:       "||",
+	EntityCode:          "`",
+}
+
+// renderMarkdownV2 выводит текст с форматированием в MarkdownV2 для Telegram
+func renderMarkdownV2(text string, entities []Entity) string {
+	return renderEntities(text, entities, markup{
+		open: func(entity Entity) string {
+			switch entity.Type {
+			case EntityPre:
+				return "```" + entity.Language + "\n"
+			case EntityTextLink:
+				return "["
+			}
+			return markdownV2Markers[entity.Type]
+		},
+		close: func(entity Entity) string {
+			switch entity.Type {
+			case EntityPre:
+				return "\n```"
+			case EntityTextLink:
+				return "](" + strings.NewReplacer(`\`, `\\`, `)`, `\)`).Replace(entity.URL) + ")"
+			case EntityItalic:
+				// Telegram игнорирует \r, он отделяет конец курсива от конца подчёркивания
+				return "_\r"
+			}
+			return markdownV2Markers[entity.Type]
+		},
+		// Ссылки без разметки MarkdownV2 экранирует как обычный текст
+		raw: func(entity Entity) bool {
+			return entity.Type == EntityCode || entity.Type == EntityPre
+		},
+		escape: func(text string, raw bool) string {
+			if raw {
+				return strings.NewReplacer("`", "\\`", `\`, `\\`).Replace(text)
+			}
+			return escapeMarkdownV2(text)
+		},
+	})
+}
+
+// Символы разметки Discord, которые экранируются в обычном тексте.
+// Экранированная угловая скобка не даёт тексту вида <@id> стать упоминанием
+var discordEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"`", "\\`",
+	`*`, `\*`,
+	`_`, `\_`,
+	`~`, `\~`,
+	`|`, `\|`,
+	`<`, `\<`,
+)
+
+// renderDiscordMarkdown выводит текст с форматированием в разметке Discord
+func renderDiscordMarkdown(text string, entities []Entity) string {
+	return renderEntities(text, entities, markup{
+		open: func(entity Entity) string {
+			switch entity.Type {
+			case EntityPre:
+				return "```" + entity.Language + "\n"
+			case EntityTextLink:
+				// Discord показывает ссылкой с текстом только http(s)
+				if isWebURL(entity.URL) {
+					return "["
+				}
+				return ""
+			}
+			return discordEntityMarkers[entity.Type]
+		},
+		close: func(entity Entity) string {
+			switch entity.Type {
+			case EntityPre:
+				return "\n```"
+			case EntityTextLink:
+				if isWebURL(entity.URL) {
+					return "](" + entity.URL + ")"
+				}
+				return ""
+			}
+			return discordEntityMarkers[entity.Type]
+		},
+		escape: func(text string, raw bool) string {
+			if raw {
+				return text
+			}
+			return discordEscaper.Replace(text)
+		},
+		// Упоминания известных пользователей Discord становятся настоящими упоминаниями
+		replace: func(entity Entity) (string, bool) {
+			if entity.Type == EntityMention && entity.UserID != "" {
+				return "<@" + entity.UserID + ">", true
+			}
+			return "", false
+		},
+	})
+}
+
+// isWebURL является ли ссылка адресом http(s)
+func isWebURL(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+}
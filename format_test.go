@@ -0,0 +1,145 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDiscordMarkdown(t *testing.T) {
+	resolve := func(kind, id string) string {
+		if kind == "#" {
+			return "#general"
+		}
+		return "@alice"
+	}
+	tests := []struct {
+		name     string
+		src      string
+		text     string
+		entities []Entity
+	}{
+		{"plain", "plain text", "plain text", nil},
+		{"bold and italic", "**bold** and *it*", "bold and it", []Entity{
+			{Type: EntityBold, Offset: 0, Length: 4},
+			{Type: EntityItalic, Offset: 9, Length: 2},
+		}},
+		{"bold italic", "***both***", "both", []Entity{
+			{Type: EntityItalic, Offset: 0, Length: 4},
+			{Type: EntityBold, Offset: 0, Length: 4},
+		}},
+		{"underline italic", "___both___", "both", []Entity{
+			{Type: EntityItalic, Offset: 0, Length: 4},
+			{Type: EntityUnderline, Offset: 0, Length: 4},
+		}},
+		{"other markers", "__u__ ~~s~~ ||sp||", "u s sp", []Entity{
+			{Type: EntityUnderline, Offset: 0, Length: 1},
+			{Type: EntityStrikethrough, Offset: 2, Length: 1},
+			{Type: EntitySpoiler, Offset: 4, Length: 2},
+		}},
+		{"snake case", "snake_case_name", "snake_case_name", nil},
+		{"escaped", `\*not italic\*`, "*not italic*", nil},
+		{"unclosed", "**open", "**open", nil},
+		{"code", "`a*b*`", "a*b*", []Entity{{Type: EntityCode, Offset: 0, Length: 4}}},
+		{"code block", "```go\nfmt.Println()\n```", "fmt.Println()", []Entity{
+			{Type: EntityPre, Offset: 0, Length: 13, Language: "go"},
+		}},
+		{"masked link", "[**site**](https://example.com)", "site", []Entity{
+			{Type: EntityBold, Offset: 0, Length: 4},
+			{Type: EntityTextLink, Offset: 0, Length: 4, URL: "https://example.com"},
+		}},
+		{"bare url", "see https://example.com/__init__.py.", "see https://example.com/__init__.py.", []Entity{
+			{Type: EntityURL, Offset: 4, Length: 31},
+		}},
+		{"quiet url", "<https://example.com>", "https://example.com", []Entity{
+			{Type: EntityURL, Offset: 0, Length: 19},
+		}},
+		{"emoji", "<:smile:123> <a:wave:456>", ":smile: :wave:", nil},
+		{"broken emoji", "<:x <:smile:123>", "<:x :smile:", nil},
+		{"mentions", "<@42> in <#7>", "@alice in #general", []Entity{
+			{Type: EntityMention, Offset: 0, Length: 6, UserID: "42"},
+		}},
+		{"utf16 offsets", "😀 **b**", "😀 b", []Entity{{Type: EntityBold, Offset: 3, Length: 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := parseDiscordMarkdown(tt.src, resolve)
+			if text != tt.text {
+				t.Errorf("text = %q, want %q", text, tt.text)
+			}
+			if !reflect.DeepEqual(entities, tt.entities) {
+				t.Errorf("entities = %+v, want %+v", entities, tt.entities)
+			}
+		})
+	}
+}
+
+func TestRenderMarkdownV2(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		entities []Entity
+		want     string
+	}{
+		{"escape", "a.b (c)!", nil, `a\.b \(c\)\!`},
+		{"bold", "bold", []Entity{{Type: EntityBold, Offset: 0, Length: 4}}, "*bold*"},
+		{"italic", "it", []Entity{{Type: EntityItalic, Offset: 0, Length: 2}}, "_it_\r"},
+		{"bold italic", "both", []Entity{
+			{Type: EntityItalic, Offset: 0, Length: 4},
+			{Type: EntityBold, Offset: 0, Length: 4},
+		}, "*_both_\r*"},
+		{"code", "a`b\\.", []Entity{{Type: EntityCode, Offset: 0, Length: 5}}, "`a\\`b\\\\.`"},
+		{"pre", "x := 1", []Entity{{Type: EntityPre, Offset: 0, Length: 6, Language: "go"}}, "```go\nx := 1\n```"},
+		{"text link", "x", []Entity{{Type: EntityTextLink, Offset: 0, Length: 1, URL: "https://e.com/a)"}}, `[x](https://e.com/a\))`},
+		{"url", "https://e.com/__init__.py", []Entity{{Type: EntityURL, Offset: 0, Length: 25}}, `https://e\.com/\_\_init\_\_\.py`},
+		{"overlap is clipped", "abcd", []Entity{
+			{Type: EntityBold, Offset: 0, Length: 3},
+			{Type: EntityItalic, Offset: 1, Length: 3},
+		}, "*a_bc_\r*d"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderMarkdownV2(tt.text, tt.entities); got != tt.want {
+				t.Errorf("renderMarkdownV2() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderDiscordMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		entities []Entity
+		want     string
+	}{
+		{"escape", "a*b_c", nil, `a\*b\_c`},
+		{"escape mention", "hi <@42>", nil, `hi \<@42>`},
+		{"mention", "@alice hi", []Entity{{Type: EntityMention, Offset: 0, Length: 6, UserID: "42"}}, "<@42> hi"},
+		{"unknown mention", "@bob", []Entity{{Type: EntityMention, Offset: 0, Length: 4}}, "@bob"},
+		{"non-web link", "user", []Entity{{Type: EntityTextLink, Offset: 0, Length: 4, URL: "tg://user?id=1"}}, "user"},
+		{"url", "https://e.com/a_b", []Entity{{Type: EntityURL, Offset: 0, Length: 17}}, "https://e.com/a_b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderDiscordMarkdown(tt.text, tt.entities); got != tt.want {
+				t.Errorf("renderDiscordMarkdown() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscordMarkdownRoundTrip(t *testing.T) {
+	tests := []string{
+		"**bold** *it* __u__ ~~s~~ ||sp||",
+		"***bold italic***",
+		"[site](https://example.com)",
+		"`code` and ```go\nx := 1\n```",
+		"see https://example.com/a_b",
+	}
+	for _, src := range tests {
+		text, entities := parseDiscordMarkdown(src, nil)
+		if got := renderDiscordMarkdown(text, entities); got != src {
+			t.Errorf("round trip of %q = %q", src, got)
+		}
+	}
+}
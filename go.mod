@@ -3,7 +3,7 @@ module chinascout
 go 1.20
 
 require (
-	github.com/bwmarrin/discordgo v0.24.1
+	github.com/bwmarrin/discordgo v0.27.1
 	github.com/go-telegram-bot-api/telegram-bot-api/v5 v5.5.1
 	github.com/joho/godotenv v1.5.1
 )
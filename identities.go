@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Структура для связи аккаунтов одного человека в Discord и Telegram
+type Identity struct {
+	DiscordID        string `json:"discord_id"`
+	TelegramID       int64  `json:"telegram_id"`
+	TelegramUsername string `json:"telegram_username,omitempty"`
+}
+
+// Сколько действует код для связывания аккаунтов
+const linkCodeTTL = 10 * time.Minute
+
+// Символы кода связывания: без похожих друг на друга 0/O и 1/I
+const linkCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// Длина кода связывания
+const linkCodeLength = 6
+
+// Ошибки погашения кода связывания
+var (
+	ErrLinkCodeInvalid      = errors.New("unknown or expired link code")
+	ErrLinkCodeSamePlatform = errors.New("link code must be redeemed on the other platform")
+)
+
+// Структура для выданного кода связывания
+type linkCode struct {
+	platform string // платформа, на которой код выдан
+	userID   string
+	username string
+	expires  time.Time
+}
+
+// Структура для списка связанных аккаунтов
+type Identities struct {
+	mu         sync.Mutex
+	identities []*Identity
+	codes      map[string]*linkCode
+	isModified bool // Флаг, который указывает на изменения
+}
+
+// Создание пустого списка связанных аккаунтов
+func NewIdentities() *Identities {
+	return &Identities{codes: make(map[string]*linkCode)}
+}
+
+// IssueCode выдаёт одноразовый код, которым пользователь платформы platform
+// подтверждает связь со своим аккаунтом на другой платформе
+func (i *Identities) IssueCode(platform, userID, username string) (string, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for code, issued := range i.codes {
+		// У пользователя действует только последний код
+		if time.Now().After(issued.expires) || issued.platform == platform && issued.userID == userID {
+			delete(i.codes, code)
+		}
+	}
+
+	for {
+		code := make([]byte, linkCodeLength)
+		for n := range code {
+			index, err := rand.Int(rand.Reader, big.NewInt(int64(len(linkCodeAlphabet))))
+			if err != nil {
+				return "", fmt.Errorf("failed to generate link code: %v", err)
+			}
+			code[n] = linkCodeAlphabet[index.Int64()]
+		}
+		if _, exists := i.codes[string(code)]; !exists {
+			i.codes[string(code)] = &linkCode{
+				platform: platform,
+				userID:   userID,
+				username: username,
+				expires:  time.Now().Add(linkCodeTTL),
+			}
+			return string(code), nil
+		}
+	}
+}
+
+// Redeem погашает код, выданный на другой платформе, и связывает аккаунт
+// пользователя platform с аккаунтом, для которого выдан код
+func (i *Identities) Redeem(code, platform, userID, username string) (*Identity, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	code = strings.ToUpper(strings.TrimSpace(code))
+	issued, exists := i.codes[code]
+	if !exists || time.Now().After(issued.expires) {
+		delete(i.codes, code)
+		return nil, ErrLinkCodeInvalid
+	}
+	if issued.platform == platform {
+		return nil, ErrLinkCodeSamePlatform
+	}
+	delete(i.codes, code)
+
+	discord, telegram := issued, &linkCode{userID: userID, username: username}
+	if platform == PlatformDiscord {
+		discord, telegram = telegram, issued
+	}
+	telegramID, err := strconv.ParseInt(telegram.userID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Telegram user ID %q: %v", telegram.userID, err)
+	}
+
+	identity := &Identity{
+		DiscordID:        discord.userID,
+		TelegramID:       telegramID,
+		TelegramUsername: strings.TrimPrefix(telegram.username, "@"),
+	}
+	i.link(identity)
+	return identity, nil
+}
+
+// link добавляет связь аккаунтов, заменяя прежние связи обоих аккаунтов.
+// Вызывается под блокировкой
+func (i *Identities) link(identity *Identity) {
+	identities := i.identities[:0]
+	for _, existing := range i.identities {
+		sameTelegram := existing.TelegramID == identity.TelegramID ||
+			existing.TelegramID == 0 && identity.TelegramUsername != "" && strings.EqualFold(existing.TelegramUsername, identity.TelegramUsername)
+		if existing.DiscordID != identity.DiscordID && !sameTelegram {
+			identities = append(identities, existing)
+		}
+	}
+	i.identities = append(identities, identity)
+	i.isModified = true
+}
+
+// DiscordID возвращает ID пользователя Discord, связанного с пользователем Telegram.
+// Пользователь Telegram ищется по ID, а если он неизвестен, по имени пользователя
+func (i *Identities) DiscordID(telegramID, telegramUsername string) string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	id, _ := strconv.ParseInt(telegramID, 10, 64)
+	telegramUsername = strings.TrimPrefix(telegramUsername, "@")
+	for _, identity := range i.identities {
+		if id != 0 && identity.TelegramID == id {
+			return identity.DiscordID
+		}
+		if id == 0 && telegramUsername != "" && strings.EqualFold(identity.TelegramUsername, telegramUsername) {
+			return identity.DiscordID
+		}
+	}
+	return ""
+}
+
+// TelegramID возвращает ID пользователя Telegram, связанного с пользователем Discord
+func (i *Identities) TelegramID(discordID string) string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for _, identity := range i.identities {
+		if identity.DiscordID == discordID && identity.TelegramID != 0 {
+			return strconv.FormatInt(identity.TelegramID, 10)
+		}
+	}
+	return ""
+}
+
+// Сохранение связанных аккаунтов в файл
+func (i *Identities) SaveToFile(filepath string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	// Если изменений не было, не сохраняем файл
+	if !i.isModified {
+		return nil
+	}
+
+	file, err := os.Create(filepath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+	defer file.Close()
+
+	if err := json.NewEncoder(file).Encode(i.identities); err != nil {
+		return fmt.Errorf("failed to encode identities: %v", err)
+	}
+
+	i.isModified = false
+	return nil
+}
+
+// Загрузка связанных аккаунтов из файла
+func (i *Identities) LoadFromFile(filepath string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	file, err := os.Open(filepath)
+	if err != nil {
+		// Если файл не существует, не считаем это ошибкой
+		if os.IsNotExist(err) {
+			log.Printf("File %s does not exist. Starting with no linked accounts.", filepath)
+			return nil
+		}
+		return fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&i.identities); err != nil {
+		return fmt.Errorf("failed to decode identities: %v", err)
+	}
+
+	log.Printf("Loaded %d linked accounts from %s", len(i.identities), filepath)
+	return nil
+}
+
+// Функция для периодического сохранения связанных аккаунтов
+func (i *Identities) PeriodicSave(filepath string) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := i.SaveToFile(filepath); err != nil {
+			log.Printf("Failed to save identities to file: %v", err)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Команда связывания аккаунтов в Discord
+var discordLinkCommand = &discordgo.ApplicationCommand{
+	Name:        "link",
+	Description: "Связать аккаунт Discord с аккаунтом Telegram",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "code",
+			Description: "Код, полученный в Telegram. Без кода бот выдаст код для Telegram",
+		},
+	},
+}
+
+// Команда связывания аккаунтов в меню Telegram
+var telegramLinkCommand = tgbotapi.BotCommand{Command: "link", Description: "Связать аккаунт Telegram с Discord"}
+
+// Структура для команд связывания аккаунтов: код, выданный на одной
+// платформе, вводится на другой
+type LinkCommands struct {
+	identities *Identities
+	bot        *tgbotapi.BotAPI
+}
+
+// Создание команд связывания аккаунтов
+func NewLinkCommands(identities *Identities, bot *tgbotapi.BotAPI) *LinkCommands {
+	return &LinkCommands{identities: identities, bot: bot}
+}
+
+// HandleDiscordCommand обработка команды !link [код]. Возвращает true, если сообщение было командой
+func (l *LinkCommands) HandleDiscordCommand(s *discordgo.Session, m *discordgo.MessageCreate) bool {
+	parts := strings.Fields(m.Content)
+	if len(parts) == 0 || parts[0] != "!link" {
+		return false
+	}
+
+	if len(parts) > 1 {
+		s.ChannelMessageSend(m.ChannelID, l.redeem(parts[1], PlatformDiscord, m.Author.ID, m.Author.Username))
+		return true
+	}
+
+	// Код отправляется в личные сообщения, чтобы его не ввёл кто-то другой
+	text := l.issue(PlatformDiscord, m.Author.ID, m.Author.Username)
+	channel, err := s.UserChannelCreate(m.Author.ID)
+	if err == nil {
+		_, err = s.ChannelMessageSend(channel.ID, text)
+	}
+	if err != nil {
+		log.Printf("Failed to send link code to Discord user %s: %v", m.Author.ID, err)
+		s.ChannelMessageSend(m.ChannelID, "❌ Не удалось отправить код в личные сообщения. Используйте команду /link.")
+		return true
+	}
+	s.ChannelMessageSend(m.ChannelID, "📬 Код для связи аккаунтов отправлен в личные сообщения.")
+	return true
+}
+
+// HandleInteraction обработка команды /link в Discord. Возвращает true, если это была она
+func (l *LinkCommands) HandleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) bool {
+	if i.Type != discordgo.InteractionApplicationCommand || i.ApplicationCommandData().Name != discordLinkCommand.Name {
+		return false
+	}
+
+	user := i.User
+	if i.Member != nil {
+		user = i.Member.User
+	}
+	if user == nil {
+		return true
+	}
+
+	for _, option := range i.ApplicationCommandData().Options {
+		if option.Name == "code" {
+			RespondEphemeral(s, i, l.redeem(option.StringValue(), PlatformDiscord, user.ID, user.Username))
+			return true
+		}
+	}
+	RespondEphemeral(s, i, l.issue(PlatformDiscord, user.ID, user.Username))
+	return true
+}
+
+// HandleTelegramCommand обработка команды /link [код] в Telegram. Возвращает true, если это была она
+func (l *LinkCommands) HandleTelegramCommand(m *tgbotapi.Message) bool {
+	if m.Command() != telegramLinkCommand.Command || !isOwnCommand(l.bot, m) {
+		return false
+	}
+	if m.From == nil {
+		replyTelegram(l.bot, m, "❌ Связать можно только аккаунт пользователя, а не чата.")
+		return true
+	}
+
+	userID := strconv.FormatInt(m.From.ID, 10)
+	if code := strings.TrimSpace(m.CommandArguments()); code != "" {
+		replyTelegram(l.bot, m, l.redeem(code, PlatformTelegram, userID, m.From.UserName))
+		return true
+	}
+
+	// Код отправляется в личные сообщения, чтобы его не ввёл кто-то другой
+	text := l.issue(PlatformTelegram, userID, m.From.UserName)
+	if m.Chat.IsPrivate() {
+		replyTelegram(l.bot, m, text)
+		return true
+	}
+	if _, err := l.bot.Send(tgbotapi.NewMessage(m.From.ID, text)); err != nil {
+		log.Printf("Failed to send link code to Telegram user %d: %v", m.From.ID, err)
+		replyTelegram(l.bot, m, fmt.Sprintf("❌ Не удалось отправить код в личные сообщения. Напишите боту @%s и повторите команду там.", l.bot.Self.UserName))
+		return true
+	}
+	replyTelegram(l.bot, m, "📬 Код для связи аккаунтов отправлен в личные сообщения.")
+	return true
+}
+
+// issue выдаёт код и возвращает текст с инструкцией для пользователя
+func (l *LinkCommands) issue(platform, userID, username string) string {
+	code, err := l.identities.IssueCode(platform, userID, username)
+	if err != nil {
+		log.Printf("Failed to issue link code for %s user %s: %v", platform, userID, err)
+		return "❌ Не удалось выдать код, попробуйте ещё раз."
+	}
+
+	minutes := int(linkCodeTTL.Minutes())
+	if platform == PlatformDiscord {
+		return fmt.Sprintf("🔗 Код для связи аккаунтов: %s\nОтправьте боту в Telegram команду /link %s в течение %d минут.", code, code, minutes)
+	}
+	return fmt.Sprintf("🔗 Код для связи аккаунтов: %s\nОтправьте в Discord команду /link с этим кодом или !link %s в течение %d минут.", code, code, minutes)
+}
+
+// redeem погашает код и возвращает текст с результатом для пользователя
+func (l *LinkCommands) redeem(code, platform, userID, username string) string {
+	identity, err := l.identities.Redeem(code, platform, userID, username)
+	switch {
+	case errors.Is(err, ErrLinkCodeInvalid):
+		return "❌ Код не найден или устарел. Получите новый командой /link на другой платформе."
+	case errors.Is(err, ErrLinkCodeSamePlatform):
+		return "❌ Этот код нужно ввести на другой платформе."
+	case err != nil:
+		log.Printf("Failed to redeem link code for %s user %s: %v", platform, userID, err)
+		return "❌ Не удалось связать аккаунты."
+	}
+
+	log.Printf("Linked Discord user %s with Telegram user %d", identity.DiscordID, identity.TelegramID)
+	return "✅ Аккаунты Discord и Telegram связаны."
+}
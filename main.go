@@ -1,15 +1,17 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
-	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
-	"time"
 
 	"github.com/bwmarrin/discordgo"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -19,6 +21,8 @@ import (
 // escapeMarkdownV2 экранирует спецсимволы для MarkdownV2
 func escapeMarkdownV2(text string) string {
 	replacer := strings.NewReplacer(
+		`\`, `\\`,
+		"`", "\\`",
 		`_`, `\_`,
 		`*`, `\*`,
 		`[`, `\[`,
@@ -40,49 +44,6 @@ func escapeMarkdownV2(text string) string {
 	return replacer.Replace(text)
 }
 
-// downloadFile скачивает файл по URL и сохраняет его по указанному пути
-func downloadFile(url, filepath string) error {
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	out, err := os.Create(filepath)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	_, err = io.Copy(out, resp.Body)
-	return err
-}
-
-// sendFileToDiscord отправка файла в Discord
-func sendFileToDiscord(dg *discordgo.Session, channelID string, filePath string, caption string) error {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return fmt.Errorf("Failed to open file: %v", err)
-	}
-	defer file.Close()
-
-	// Отправка сообщения с подписью
-	if caption != "" {
-		_, err = dg.ChannelMessageSend(channelID, caption)
-		if err != nil {
-			return fmt.Errorf("Failed to send message to Discord: %v", err)
-		}
-	}
-
-	// Отправка файла
-	_, err = dg.ChannelFileSend(channelID, filePath, file)
-	if err != nil {
-		return fmt.Errorf("Failed to send file to Discord: %v", err)
-	}
-
-	return nil
-}
-
 // parseChatID преобразует строковый Telegram Chat ID в int64
 func parseChatID(chatID string) (int64, error) {
 	var parsedChatID int64
@@ -102,6 +63,16 @@ func main() {
 	telegramChatID := os.Getenv("TELEGRAM_CHAT_ID")
 	discordChannelID := os.Getenv("DISCORD_CHANNEL_ID")
 	adminFilePath := os.Getenv("ADMIN_FILE_PATH")
+	bridgeConfigPath := os.Getenv("BRIDGE_CONFIG_PATH")
+	avatarListenAddr := os.Getenv("AVATAR_LISTEN_ADDR")
+	avatarPublicURL := os.Getenv("AVATAR_PUBLIC_URL")
+	// Вебхук Telegram вместо long polling: публичный адрес, адрес для прослушивания,
+	// секрет и, если TLS не завершается на обратном прокси, сертификат с ключом
+	telegramWebhookURL := os.Getenv("TELEGRAM_WEBHOOK_URL")
+	telegramWebhookListenAddr := os.Getenv("TELEGRAM_WEBHOOK_LISTEN_ADDR")
+	telegramWebhookSecret := os.Getenv("TELEGRAM_WEBHOOK_SECRET")
+	telegramWebhookCert := os.Getenv("TELEGRAM_WEBHOOK_CERT")
+	telegramWebhookKey := os.Getenv("TELEGRAM_WEBHOOK_KEY")
 
 	// Инициализация рейтинга
 	ranking, err := NewRanking(adminFilePath)
@@ -118,28 +89,78 @@ func main() {
 	// Запуск периодического сохранения в отдельной горутине
 	go ranking.PeriodicSave("users.json")
 
-	// Обработка сигналов завершения для корректного сохранения данных
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		sig := <-sigs
-		log.Printf("Received signal %s. Saving users to file before shutdown...", sig)
-		err := ranking.SaveToFile("users.json")
-		if err != nil {
-			log.Printf("Failed to save users to file on shutdown: %v", err)
-		}
-		os.Exit(0)
-	}()
+	// Загрузка связей пересланных сообщений
+	messageStore := NewMessageStore()
+	err = messageStore.LoadFromFile("messages.json")
+	if err != nil {
+		log.Printf("Failed to load message links from file: %v", err)
+	}
+	go messageStore.PeriodicSave("messages.json")
+
+	// Загрузка очереди недоставленных сообщений
+	deliveryQueue := NewDeliveryQueue()
+	err = deliveryQueue.LoadFromFile("queue.json")
+	if err != nil {
+		log.Printf("Failed to load delivery queue from file: %v", err)
+	}
+	go deliveryQueue.PeriodicSave("queue.json")
+
+	// Загрузка связанных аккаунтов Discord и Telegram
+	identities := NewIdentities()
+	err = identities.LoadFromFile("identities.json")
+	if err != nil {
+		log.Printf("Failed to load identities from file: %v", err)
+	}
+	go identities.PeriodicSave("identities.json")
+
+	// Загрузка связей веток Discord с темами форумов Telegram
+	threads := NewThreads()
+	err = threads.LoadFromFile("threads.json")
+	if err != nil {
+		log.Printf("Failed to load threads from file: %v", err)
+	}
+	go threads.PeriodicSave("threads.json")
+
+	// Загрузка фильтров моста; файл перечитывается при изменении
+	filters := NewFilters("filters.json")
+	err = filters.LoadFromFile()
+	if err != nil {
+		log.Printf("Failed to load bridge filters from file: %v", err)
+	}
+	go filters.PeriodicReload()
 
 	// Проверка обязательных переменных
-	if discordToken == "" || telegramToken == "" || telegramChatID == "" || discordChannelID == "" || adminFilePath == "" {
+	if discordToken == "" || telegramToken == "" || adminFilePath == "" {
 		log.Fatal("Missing required environment variables")
 	}
+	if telegramWebhookURL != "" && (telegramWebhookListenAddr == "" || telegramWebhookSecret == "") {
+		log.Fatal("TELEGRAM_WEBHOOK_URL requires TELEGRAM_WEBHOOK_LISTEN_ADDR and TELEGRAM_WEBHOOK_SECRET")
+	}
 
-	chatID, err := parseChatID(telegramChatID)
-	if err != nil {
-		log.Fatalf("Invalid Telegram Chat ID: %v", err)
+	// Загрузка маршрутов моста: из файла конфигурации или из пары
+	// DISCORD_CHANNEL_ID / TELEGRAM_CHAT_ID
+	var bridgeConfig *BridgeConfig
+	if bridgeConfigPath != "" {
+		bridgeConfig, err = LoadBridgeConfig(bridgeConfigPath)
+		if err != nil {
+			log.Fatalf("Failed to load bridge config: %v", err)
+		}
+	} else {
+		if telegramChatID == "" || discordChannelID == "" {
+			log.Fatal("Missing required environment variables")
+		}
+		chatID, err := parseChatID(telegramChatID)
+		if err != nil {
+			log.Fatalf("Invalid Telegram Chat ID: %v", err)
+		}
+		route := &Route{DiscordChannelID: discordChannelID, TelegramChatID: chatID}
+		if err := route.normalize(); err != nil {
+			log.Fatalf("Invalid bridge route: %v", err)
+		}
+		bridgeConfig = &BridgeConfig{Routes: []*Route{route}}
 	}
+	routes := NewRoutes(bridgeConfig.Routes)
+	log.Printf("Loaded %d bridge routes", len(bridgeConfig.Routes))
 
 	// Инициализация Telegram бота
 	tgBot, err := tgbotapi.NewBotAPI(telegramToken)
@@ -154,205 +175,180 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to initialize Discord bot: %v", err)
 	}
-	dg.Identify.Intents = discordgo.IntentsGuildMessages | discordgo.IntentMessageContent | discordgo.IntentsGuildVoiceStates
+	// Обработчики вызываются по очереди в порядке событий, иначе правка или
+	// удаление сообщения могут обогнать его создание. Поэтому обработчики не
+	// должны блокироваться: долгая работа выполняется в отдельных горутинах
+	dg.SyncEvents = true
+	dg.Identify.Intents = discordgo.IntentsGuilds | discordgo.IntentsGuildMessages | discordgo.IntentsGuildMessageReactions | discordgo.IntentMessageContent | discordgo.IntentsGuildVoiceStates
 
 	// Отслеживание активности в голосовых каналах
 	ranking.TrackVoiceActivity(dg)
 
-	// Обработчик сообщений Discord
-	dg.AddHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) {
-		log.Println("Discord message handler triggered.")
-		if m.Author.ID == s.State.User.ID {
-			return
+	// Платформы моста
+	discord := NewDiscordPlatform(dg)
+	links := NewLinkCommands(identities, tgBot)
+	discord.SetCommandHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) bool {
+		// Связывание аккаунтов работает в любом канале
+		if links.HandleDiscordCommand(s, m) {
+			return true
 		}
-		if m.ChannelID != discordChannelID {
-			return
+		if !routes.HasDiscordChannel(m.ChannelID) {
+			return false
 		}
-
-		// Логирование полученного сообщения
-		log.Printf("Received message: %s from %s", m.Content, m.Author.Username)
-
-		// Обработка команд
-		if strings.HasPrefix(m.Content, "!") {
-			if strings.HasPrefix(m.Content, "!china") {
-				ranking.HandleChinaCommand(s, m, m.Content)
+		return ranking.HandleCommand(s, m)
+	})
+	dg.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		go func() {
+			if links.HandleInteraction(s, i) {
 				return
 			}
-
-			if m.Content == "!top5" {
-				topUsers := ranking.GetTop5()
-				if len(topUsers) == 0 {
-					s.ChannelMessageSend(m.ChannelID, "Демография владельцев Социальных Кредитов пока пуста.")
-					return
-				}
-				response := "Топ-5 жителей Китая:\n"
-				for i, user := range topUsers {
-					response += fmt.Sprintf("%d. <@%s> - %d очков\n", i+1, user.ID, user.Rating)
-				}
-				s.ChannelMessageSend(m.ChannelID, response)
+			// Кнопки, автодополнение и прочие взаимодействия командами не являются
+			if i.Type != discordgo.InteractionApplicationCommand {
 				return
 			}
-
-			if strings.HasPrefix(m.Content, "!rating") {
-				parts := strings.Fields(m.Content)
-				if len(parts) < 2 {
-					s.ChannelMessageSend(m.ChannelID, "❌ Глупый Китайский житель! Вводи данные из привелегии правильно! Пример: !rating @username")
-					return
-				}
-				userID := strings.TrimPrefix(parts[1], "<@")
-				userID = strings.TrimSuffix(userID, ">") // Удаление завершающего >
-				// Удаление '!' из упоминания, если есть
-				userID = strings.TrimPrefix(userID, "!")
-				rating := ranking.GetRating(userID)
-				s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Социальные кредиты жителя Китая <@%s>: %d баллов", userID, rating))
+			if !routes.HasDiscordChannel(i.ChannelID) {
+				RespondEphemeral(s, i, "❌ Команды рейтинга работают только в каналах моста.")
 				return
 			}
+			ranking.HandleInteraction(s, i)
+		}()
+	})
+	telegram := NewTelegramPlatform(tgBot)
+	telegramCommands := NewTelegramRankingCommands(tgBot, ranking, identities, messageStore, func(chatID, userID string) string {
+		return discord.DisplayName(routes.DiscordChannel(chatID), userID)
+	})
+	telegram.SetCommandHandler(func(m *tgbotapi.Message) bool {
+		// Связывание аккаунтов работает и в личных сообщениях боту
+		if links.HandleTelegramCommand(m) {
+			return true
 		}
-
-		// Отправка сообщений и файлов в Telegram (если не команда)
-		if m.Content != "" {
-			escapedContent := escapeMarkdownV2(m.Content)
-			escapedUsername := escapeMarkdownV2(m.Author.Username)
-			telegramMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("🎧:\n*%s*: %s", escapedUsername, escapedContent))
-			telegramMsg.ParseMode = "MarkdownV2"
-			if _, err := tgBot.Send(telegramMsg); err != nil {
-				log.Printf("Failed to send message to Telegram: %v", err)
-			}
-		}
-
-		if len(m.Attachments) > 0 {
-			for _, attachment := range m.Attachments {
-				if strings.HasPrefix(attachment.ContentType, "image/") {
-					photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileURL(attachment.URL))
-					photo.Caption = fmt.Sprintf("🎧:\n %s", m.Author.Username)
-					if _, err := tgBot.Send(photo); err != nil {
-						log.Printf("Failed to send image to Telegram: %v", err)
-					}
-				}
-			}
+		if !routes.HasTelegramChat(strconv.FormatInt(m.Chat.ID, 10)) {
+			return false
 		}
+		return telegramCommands.Handle(m)
 	})
+	if err := telegramCommands.Register(telegramLinkCommand); err != nil {
+		log.Printf("Failed to register Telegram bot commands: %v", err)
+	}
 
-	// Запуск Discord бота
-	if err := dg.Open(); err != nil {
-		log.Fatalf("Failed to open Discord session: %v", err)
+	// HTTP-серверы по адресам прослушивания: аватары и вебхук Telegram
+	// могут работать на одном адресе
+	servers := make(map[string]*http.ServeMux)
+	serverMux := func(addr string) *http.ServeMux {
+		if servers[addr] == nil {
+			servers[addr] = http.NewServeMux()
+		}
+		return servers[addr]
 	}
-	defer dg.Close()
-	log.Println("Discord bot is running.")
 
-	// Обработчик сообщений Telegram (это уже работает)
-	updateConfig := tgbotapi.NewUpdate(0)
-	updateConfig.Timeout = 60
-	updates := tgBot.GetUpdatesChan(updateConfig)
+	// Сервер аватаров для сообщений, отправляемых в Discord через вебхук
+	if avatarListenAddr != "" && avatarPublicURL != "" {
+		avatars := NewAvatarServer(tgBot, avatarPublicURL)
+		telegram.SetAvatars(avatars)
+		serverMux(avatarListenAddr).Handle("/avatars/", avatars)
+		log.Printf("Serving Telegram avatars on %s", avatarListenAddr)
+	}
 
-	for update := range updates {
-		if update.Message == nil || update.Message.Chat.ID != chatID {
-			continue
+	// Приём обновлений Telegram через вебхук
+	if telegramWebhookURL != "" {
+		webhookURL, err := url.Parse(telegramWebhookURL)
+		if err != nil {
+			log.Fatalf("Invalid Telegram webhook URL: %v", err)
 		}
-
-		// 1. Отправка текста в Discord
-		if update.Message.Text != "" {
-			telegramMsg := fmt.Sprintf("➤ \n**%s**: %s", update.Message.From.UserName, update.Message.Text)
-			_, err := dg.ChannelMessageSend(discordChannelID, telegramMsg)
-			if err != nil {
-				log.Printf("Failed to send text message to Discord: %v", err)
-			}
+		webhookPath := webhookURL.Path
+		if webhookPath == "" {
+			webhookPath = "/"
 		}
+		serverMux(telegramWebhookListenAddr).Handle(webhookPath, telegram.WebhookHandler(telegramWebhookSecret))
+		log.Printf("Receiving Telegram updates via webhook on %s%s", telegramWebhookListenAddr, webhookPath)
+	}
 
-		// 2. Обработка фото (если есть)
-		if len(update.Message.Photo) > 0 {
-			photoFileID := update.Message.Photo[len(update.Message.Photo)-1].FileID
-			fileURL, err := tgBot.GetFileDirectURL(photoFileID)
-			if err != nil {
-				log.Printf("Failed to get photo URL: %v", err)
-				continue
-			}
-
-			photoPath := fmt.Sprintf("content/photo_%d.jpg", time.Now().UnixNano())
-
-			// Скачиваем фото
-			err = downloadFile(fileURL, photoPath)
-			if err != nil {
-				log.Printf("Failed to download photo: %v", err)
-				continue
-			}
-
-			// Отправка фото в Discord
-			err = sendFileToDiscord(dg, discordChannelID, photoPath, fmt.Sprintf("➤ %s:", update.Message.From.UserName))
-			if err != nil {
-				log.Printf("Failed to send photo to Discord: %v", err)
-			}
-
-			// Удаление фото после отправки
-			err = os.Remove(photoPath)
-			if err != nil {
-				log.Printf("Failed to remove photo file: %v", err)
-			}
+	for addr, mux := range servers {
+		// Без сервера вебхука обновления Telegram не приходят, поэтому его ошибки фатальны
+		fail := log.Printf
+		if telegramWebhookURL != "" && addr == telegramWebhookListenAddr {
+			fail = log.Fatalf
 		}
-
-		// 3. Обработка видеосообщений (если есть)
-		if update.Message.VideoNote != nil {
-			// Получаем ID видеосообщения
-			videoFileID := update.Message.VideoNote.FileID
-			fileURL, err := tgBot.GetFileDirectURL(videoFileID)
-			if err != nil {
-				log.Printf("Failed to get video URL: %v", err)
-				continue
-			}
-
-			// Создаем уникальное имя для видео
-			videoPath := fmt.Sprintf("content/video_%d.mp4", time.Now().UnixNano())
-
-			// Скачиваем видео
-			err = downloadFile(fileURL, videoPath)
+		// Сертификат и адрес проверяются сразу, чтобы ошибка обнаружилась до регистрации вебхука
+		server := &http.Server{Handler: mux}
+		if addr == telegramWebhookListenAddr && telegramWebhookCert != "" {
+			certificate, err := tls.LoadX509KeyPair(telegramWebhookCert, telegramWebhookKey)
 			if err != nil {
-				log.Printf("Failed to download video: %v", err)
+				fail("Failed to load TLS certificate for %s: %v", addr, err)
 				continue
 			}
-
-			// Отправка видео в Discord
-			err = sendFileToDiscord(dg, discordChannelID, videoPath, fmt.Sprintf("➤ %s:", update.Message.From.UserName))
-			if err != nil {
-				log.Printf("Failed to send video to Discord: %v", err)
+			server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{certificate}}
+		}
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			fail("Failed to listen on %s: %v", addr, err)
+			continue
+		}
+		go func(addr string, server *http.Server, listener net.Listener, fail func(string, ...interface{})) {
+			var err error
+			if server.TLSConfig != nil {
+				err = server.ServeTLS(listener, "", "")
+			} else {
+				err = server.Serve(listener)
 			}
+			fail("HTTP server on %s stopped: %v", addr, err)
+		}(addr, server, listener, fail)
+	}
+	bridge := NewBridge(discord, telegram, routes, messageStore, identities, threads, deliveryQueue, filters)
 
-			// Удаление видео после отправки
-			err = os.Remove(videoPath)
-			if err != nil {
-				log.Printf("Failed to remove video file: %v", err)
+	// Обработка сигналов завершения для корректного сохранения данных
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		log.Printf("Received signal %s. Saving users to file before shutdown...", sig)
+		if telegramWebhookURL != "" {
+			if err := telegram.DeleteWebhook(); err != nil {
+				log.Printf("Failed to delete Telegram webhook on shutdown: %v", err)
 			}
 		}
+		err := ranking.SaveToFile("users.json")
+		if err != nil {
+			log.Printf("Failed to save users to file on shutdown: %v", err)
+		}
+		if err := messageStore.SaveToFile("messages.json"); err != nil {
+			log.Printf("Failed to save message links to file on shutdown: %v", err)
+		}
+		if err := deliveryQueue.SaveToFile("queue.json"); err != nil {
+			log.Printf("Failed to save delivery queue to file on shutdown: %v", err)
+		}
+		if err := identities.SaveToFile("identities.json"); err != nil {
+			log.Printf("Failed to save identities to file on shutdown: %v", err)
+		}
+		if err := threads.SaveToFile("threads.json"); err != nil {
+			log.Printf("Failed to save threads to file on shutdown: %v", err)
+		}
+		os.Exit(0)
+	}()
 
-		// 4. Обработка голосовых сообщений (если есть)
-		if update.Message.Voice != nil {
-			voiceFileID := update.Message.Voice.FileID
-			fileURL, err := tgBot.GetFileDirectURL(voiceFileID)
-			if err != nil {
-				log.Printf("Failed to get voice message URL: %v", err)
-				continue
-			}
-
-			// Создаем уникальное имя для голосового сообщения
-			voicePath := fmt.Sprintf("content/voice_%d.ogg", time.Now().UnixNano())
-
-			// Скачиваем голосовое сообщение
-			err = downloadFile(fileURL, voicePath)
-			if err != nil {
-				log.Printf("Failed to download voice message: %v", err)
-				continue
-			}
+	// Запуск Discord бота
+	if err := dg.Open(); err != nil {
+		log.Fatalf("Failed to open Discord session: %v", err)
+	}
+	defer dg.Close()
+	log.Println("Discord bot is running.")
 
-			// Отправка голосового сообщения в Discord
-			err = sendFileToDiscord(dg, discordChannelID, voicePath, fmt.Sprintf("➤ %s:", update.Message.From.UserName))
-			if err != nil {
-				log.Printf("Failed to send voice to Discord: %v", err)
-			}
+	// Регистрация команд рейтинга; команды с префиксом ! работают и без них
+	if err := ranking.RegisterCommands(dg, discordLinkCommand); err != nil {
+		log.Printf("Failed to register Discord application commands: %v", err)
+	}
 
-			// Удаление голосового сообщения после отправки
-			err = os.Remove(voicePath)
-			if err != nil {
-				log.Printf("Failed to remove voice file: %v", err)
-			}
+	// Запуск получения обновлений Telegram и моста
+	if telegramWebhookURL != "" {
+		if err := telegram.SetWebhook(telegramWebhookURL, telegramWebhookSecret); err != nil {
+			log.Fatalf("Failed to set Telegram webhook: %v", err)
+		}
+	} else {
+		// Оставшийся от прошлого запуска вебхук не даёт получать обновления через long polling
+		if err := telegram.DeleteWebhook(); err != nil {
+			log.Printf("Failed to delete Telegram webhook: %v", err)
 		}
+		telegram.Start()
 	}
+	bridge.Run()
 }
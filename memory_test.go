@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// Структура для сообщения, отправленного через MemoryPlatform
+type SentMessage struct {
+	ChatID  string
+	ID      string
+	Text    string
+	Files   []*Attachment
+	Caption string
+	ReplyTo string
+	Embeds  []*Embed
+	// Ветка, в которую отправлено сообщение (SendOptions.ThreadID)
+	ThreadID string
+	// Имя, от которого отправлено сообщение (SendOptions.Username)
+	Username string
+	// Реакции бота на сообщение
+	Reactions []string
+	Edits     int
+	Deleted   bool
+}
+
+// MemoryPlatform платформа в памяти без сети. Позволяет проверять логику моста
+// без токенов: входящие сообщения подаются через Receive, исходящие читаются через Sent
+type MemoryPlatform struct {
+	mu       sync.Mutex
+	name     string
+	messages chan *Message
+	sent     []SentMessage
+	users    map[string]*Sender
+	nextID   int
+
+	// Ошибка, которую возвращает CreateThread, и число его вызовов
+	threadErr   error
+	threadCalls int
+}
+
+// Создание платформы в памяти с указанным именем
+func NewMemoryPlatform(name string) *MemoryPlatform {
+	return &MemoryPlatform{
+		name:     name,
+		messages: make(chan *Message, 100),
+		users:    make(map[string]*Sender),
+	}
+}
+
+func (p *MemoryPlatform) Name() string {
+	return p.name
+}
+
+func (p *MemoryPlatform) Messages() <-chan *Message {
+	return p.messages
+}
+
+// Receive имитирует входящее сообщение
+func (p *MemoryPlatform) Receive(msg *Message) {
+	if msg.Platform == "" {
+		msg.Platform = p.name
+	}
+	p.messages <- msg
+}
+
+// Close закрывает канал входящих сообщений
+func (p *MemoryPlatform) Close() {
+	close(p.messages)
+}
+
+// AddUser регистрирует пользователя для ResolveUser
+func (p *MemoryPlatform) AddUser(user Sender) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.users[user.ID] = &user
+}
+
+// Sent возвращает копию списка отправленных сообщений
+func (p *MemoryPlatform) Sent() []SentMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sent := make([]SentMessage, len(p.sent))
+	copy(sent, p.sent)
+	return sent
+}
+
+func (p *MemoryPlatform) SendText(chatID, text string, opts SendOptions) (string, error) {
+	return p.record(SentMessage{ChatID: chatID, Text: text, ReplyTo: opts.ReplyTo, Embeds: opts.Embeds, Username: opts.Username, ThreadID: opts.ThreadID}), nil
+}
+
+func (p *MemoryPlatform) SendFiles(chatID string, files []*Attachment, caption string, opts SendOptions) ([]string, error) {
+	id := p.record(SentMessage{ChatID: chatID, Files: files, Caption: caption, ReplyTo: opts.ReplyTo, Embeds: opts.Embeds, Username: opts.Username, ThreadID: opts.ThreadID})
+	return []string{id}, nil
+}
+
+func (p *MemoryPlatform) EditText(chatID, messageID, text string) error {
+	return p.edit(chatID, messageID, func(msg *SentMessage) { msg.Text = text })
+}
+
+func (p *MemoryPlatform) EditCaption(chatID, messageID, caption string) error {
+	return p.edit(chatID, messageID, func(msg *SentMessage) { msg.Caption = caption })
+}
+
+func (p *MemoryPlatform) DeleteMessage(chatID, messageID string) error {
+	return p.edit(chatID, messageID, func(msg *SentMessage) { msg.Deleted = true })
+}
+
+func (p *MemoryPlatform) SetReactions(chatID, messageID string, emojis []string) error {
+	return p.edit(chatID, messageID, func(msg *SentMessage) { msg.Reactions = emojis })
+}
+
+func (p *MemoryPlatform) ResolveUser(userID string) (*Sender, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	user, exists := p.users[userID]
+	if !exists {
+		return nil, fmt.Errorf("user %s not found", userID)
+	}
+	return user, nil
+}
+
+// CreateThread выдаёт ID новой ветки из той же последовательности, что и ID сообщений,
+// или threadErr, если она задана
+func (p *MemoryPlatform) CreateThread(chatID, name string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.threadCalls++
+	if p.threadErr != nil {
+		return "", p.threadErr
+	}
+	p.nextID++
+	return strconv.Itoa(p.nextID), nil
+}
+
+// FileURL выдаёт ссылку по ID файла, если он есть
+func (p *MemoryPlatform) FileURL(file *Attachment) (string, error) {
+	if file.FileID == "" {
+		return file.URL, nil
+	}
+	return "memory://" + p.name + "/" + file.FileID, nil
+}
+
+// edit применяет изменение к отправленному сообщению
+func (p *MemoryPlatform) edit(chatID, messageID string, apply func(msg *SentMessage)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range p.sent {
+		if p.sent[i].ChatID == chatID && p.sent[i].ID == messageID {
+			apply(&p.sent[i])
+			p.sent[i].Edits++
+			return nil
+		}
+	}
+	return fmt.Errorf("message %s not found in chat %s", messageID, chatID)
+}
+
+// record сохраняет отправленное сообщение и выдаёт ему ID
+func (p *MemoryPlatform) record(msg SentMessage) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.nextID++
+	msg.ID = strconv.Itoa(p.nextID)
+	p.sent = append(p.sent, msg)
+	return msg.ID
+}
@@ -0,0 +1,131 @@
+package main
+
+// Имена поддерживаемых платформ
+const (
+	PlatformDiscord  = "discord"
+	PlatformTelegram = "telegram"
+)
+
+// Platform абстракция над мессенджером, с которой работает мост.
+// Реализации: DiscordPlatform, TelegramPlatform и MemoryPlatform в тестах
+type Platform interface {
+	// Name возвращает имя платформы (PlatformDiscord, PlatformTelegram)
+	Name() string
+	// SendText отправляет текст в чат и возвращает ID отправленного сообщения
+	SendText(chatID, text string, opts SendOptions) (string, error)
+	// SendFiles отправляет вложения с подписью и возвращает ID отправленных сообщений.
+	// Подпись и ответ относятся к первому сообщению
+	SendFiles(chatID string, files []*Attachment, caption string, opts SendOptions) ([]string, error)
+	// EditText заменяет текст отправленного сообщения
+	EditText(chatID, messageID, text string) error
+	// EditCaption заменяет подпись отправленного вложения
+	EditCaption(chatID, messageID, caption string) error
+	// DeleteMessage удаляет отправленное сообщение
+	DeleteMessage(chatID, messageID string) error
+	// SetReactions заменяет реакции бота на сообщение. Эмодзи упорядочены по
+	// популярности, платформа может поставить только первые из них
+	SetReactions(chatID, messageID string, emojis []string) error
+	// Messages возвращает канал входящих сообщений в нормализованном виде
+	Messages() <-chan *Message
+	// ResolveUser возвращает информацию о пользователе по его ID
+	ResolveUser(userID string) (*Sender, error)
+	// CreateThread создаёт в чате ветку (тему форума) с названием name и возвращает её ID
+	CreateThread(chatID, name string) (string, error)
+	// FileURL возвращает ссылку для скачивания вложения, полученного с этой платформы
+	FileURL(file *Attachment) (string, error)
+}
+
+// Структура для дополнительных параметров отправки
+type SendOptions struct {
+	// ID сообщения в том же чате, ответом на которое будет отправленное сообщение
+	ReplyTo string
+	// Встраиваемые блоки, прикрепляемые к текстовому сообщению. Поддерживаются
+	// только в Discord: в Telegram блоки Discord уже переданы текстом сообщения
+	Embeds []*Embed
+	// Имя и аватар, от имени которых отправляется сообщение. Поддерживается
+	// только в Discord через вебхук, ответы при этом недоступны
+	Username  string
+	AvatarURL string
+	// ID ветки Discord или темы форума Telegram, в которую отправляется сообщение
+	ThreadID string
+}
+
+// Структура для автора сообщения
+type Sender struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	// Ссылка на аватар, если платформа может его предоставить
+	AvatarURL string `json:"avatar_url,omitempty"`
+	// ID ролей автора на сервере Discord
+	Roles []string `json:"roles,omitempty"`
+}
+
+// Структура для вложения сообщения
+type Attachment struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// ID файла в Telegram. Ссылка на такой файл содержит токен бота и быстро
+	// устаревает, поэтому она получается через FileURL только при отправке
+	FileID      string `json:"file_id,omitempty"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+	Spoiler     bool   `json:"spoiler,omitempty"` // скрыть вложение под спойлер
+	Voice       bool   `json:"voice,omitempty"`   // голосовое сообщение в формате Ogg/Opus
+}
+
+// Структура для встраиваемого блока (embed): геопозиции, контакта, опроса и т.п.
+type Embed struct {
+	Title        string
+	Description  string
+	URL          string
+	Fields       []EmbedField
+	Footer       string
+	ImageURL     string
+	ThumbnailURL string
+}
+
+// Структура для поля встраиваемого блока
+type EmbedField struct {
+	Name   string
+	Value  string
+	Inline bool
+}
+
+// Структура для сообщения, на которое отвечают
+type ReplyInfo struct {
+	ID     string
+	Sender Sender
+	Text   string
+}
+
+// Виды входящих сообщений
+const (
+	MessageCreated = iota // новое сообщение
+	MessageEdited         // сообщение отредактировано
+	MessageDeleted        // сообщение удалено, заполнены только ChatID и ID
+	MessageReacted        // изменились реакции, заполнены ChatID, ID, Sender и Reactions*
+)
+
+// Структура для нормализованного входящего сообщения
+type Message struct {
+	Kind        int
+	Platform    string
+	ChatID      string
+	ID          string
+	Sender      Sender
+	Text        string   // текст без разметки
+	Entities    []Entity // форматирование текста
+	Attachments []*Attachment
+	Embeds      []*Embed
+	ReplyTo     *ReplyInfo
+
+	// Ветка Discord или тема форума Telegram, в которой написано сообщение.
+	// ChatID при этом остаётся ID канала или чата, в котором она находится
+	ThreadID   string
+	ThreadName string
+
+	// Для MessageReacted: поставленные и снятые пользователем реакции
+	ReactionsAdded   []string
+	ReactionsRemoved []string
+}
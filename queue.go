@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Сколько раз пытаться выполнить задачу доставки, прежде чем отказаться от неё
+const maxDeliveryAttempts = 10
+
+// Максимальная пауза между попытками доставки
+const maxDeliveryBackoff = 5 * time.Minute
+
+// Структура для задачи доставки сообщения по маршруту на платформу назначения
+type DeliveryJob struct {
+	ID               int64    `json:"id"`
+	Target           string   `json:"target"` // платформа назначения
+	DiscordChannelID string   `json:"discord_channel_id"`
+	TelegramChatID   int64    `json:"telegram_chat_id"`
+	Message          *Message `json:"message"`
+	Attempts         int      `json:"attempts"`
+}
+
+// Destination ключ очереди: платформа и чат назначения
+func (job *DeliveryJob) Destination() string {
+	if job.Target == PlatformDiscord {
+		return job.Target + ":" + job.DiscordChannelID
+	}
+	return fmt.Sprintf("%s:%d", job.Target, job.TelegramChatID)
+}
+
+// DeliveryFunc выполняет задачу доставки
+type DeliveryFunc func(job *DeliveryJob) error
+
+// Структура для очереди доставки. Для каждого чата назначения задачи
+// выполняются по порядку одной горутиной, поэтому порядок сообщений
+// сохраняется, а ошибка в одном чате не задерживает остальные
+type DeliveryQueue struct {
+	mu         sync.Mutex
+	queues     map[string][]*DeliveryJob
+	running    map[string]bool
+	nextID     int64
+	deliver    DeliveryFunc
+	isModified bool // Флаг, который указывает на изменения
+}
+
+// Создание пустой очереди доставки
+func NewDeliveryQueue() *DeliveryQueue {
+	return &DeliveryQueue{
+		queues:  make(map[string][]*DeliveryJob),
+		running: make(map[string]bool),
+	}
+}
+
+// Start задаёт функцию доставки и запускает выполнение задач, в том числе
+// загруженных из файла
+func (q *DeliveryQueue) Start(deliver DeliveryFunc) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.deliver = deliver
+	for destination, jobs := range q.queues {
+		if len(jobs) > 0 && !q.running[destination] {
+			q.running[destination] = true
+			go q.work(destination)
+		}
+	}
+}
+
+// Push добавляет задачу в конец очереди её чата назначения
+func (q *DeliveryQueue) Push(job *DeliveryJob) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.nextID++
+	job.ID = q.nextID
+	destination := job.Destination()
+	q.queues[destination] = append(q.queues[destination], job)
+	q.isModified = true
+
+	if q.deliver != nil && !q.running[destination] {
+		q.running[destination] = true
+		go q.work(destination)
+	}
+}
+
+// work выполняет задачи одного чата назначения, пока они есть
+func (q *DeliveryQueue) work(destination string) {
+	for {
+		q.mu.Lock()
+		jobs := q.queues[destination]
+		if len(jobs) == 0 {
+			delete(q.queues, destination)
+			delete(q.running, destination)
+			q.mu.Unlock()
+			return
+		}
+		job := jobs[0]
+		q.mu.Unlock()
+
+		err := q.deliver(job)
+		if err != nil {
+			q.mu.Lock()
+			job.Attempts++
+			attempts := job.Attempts
+			q.isModified = true
+			q.mu.Unlock()
+
+			delay, retry := retryDelay(err, attempts)
+			if retry && attempts < maxDeliveryAttempts {
+				log.Printf("Delivery job %d to %s failed (attempt %d), retrying in %s: %v", job.ID, destination, attempts, delay, err)
+				time.Sleep(delay)
+				continue
+			}
+			log.Printf("Dropping delivery job %d to %s after %d attempts: %v", job.ID, destination, attempts, err)
+		}
+
+		q.mu.Lock()
+		q.queues[destination] = q.queues[destination][1:]
+		q.isModified = true
+		q.mu.Unlock()
+	}
+}
+
+// retryDelay определяет, стоит ли повторять задачу после ошибки и через какое время.
+// Ограничения частоты запросов соблюдаются по ответу платформы, сетевые ошибки
+// и ошибки сервера повторяются с нарастающей паузой, остальные ошибки запроса
+// считаются окончательными
+func retryDelay(err error, attempt int) (time.Duration, bool) {
+	backoff := time.Second << uint(attempt-1)
+	if backoff <= 0 || backoff > maxDeliveryBackoff {
+		backoff = maxDeliveryBackoff
+	}
+
+	var telegramErr *tgbotapi.Error
+	if errors.As(err, &telegramErr) {
+		switch {
+		case telegramErr.RetryAfter > 0:
+			return time.Duration(telegramErr.RetryAfter) * time.Second, true
+		case telegramErr.Code >= 500:
+			return backoff, true
+		}
+		return 0, false
+	}
+
+	var rateLimitErr *discordgo.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return rateLimitErr.RetryAfter, true
+	}
+
+	var discordErr *discordgo.RESTError
+	if errors.As(err, &discordErr) && discordErr.Response != nil {
+		if discordErr.Response.StatusCode >= http.StatusInternalServerError {
+			return backoff, true
+		}
+		return 0, false
+	}
+
+	// Сетевые и прочие ошибки (например, ошибки загрузки вложений) повторяем
+	return backoff, true
+}
+
+// Сохранение очереди в файл
+func (q *DeliveryQueue) SaveToFile(filepath string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// Если изменений не было, не сохраняем файл
+	if !q.isModified {
+		return nil
+	}
+
+	file, err := os.Create(filepath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+	defer file.Close()
+
+	if err := json.NewEncoder(file).Encode(q.queues); err != nil {
+		return fmt.Errorf("failed to encode delivery queue: %v", err)
+	}
+
+	q.isModified = false
+	return nil
+}
+
+// Загрузка очереди из файла
+func (q *DeliveryQueue) LoadFromFile(filepath string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	file, err := os.Open(filepath)
+	if err != nil {
+		// Если файл не существует, не считаем это ошибкой
+		if os.IsNotExist(err) {
+			log.Printf("File %s does not exist. Starting with empty delivery queue.", filepath)
+			return nil
+		}
+		return fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&q.queues); err != nil {
+		return fmt.Errorf("failed to decode delivery queue: %v", err)
+	}
+
+	count := 0
+	for _, jobs := range q.queues {
+		for _, job := range jobs {
+			if job.ID > q.nextID {
+				q.nextID = job.ID
+			}
+		}
+		count += len(jobs)
+	}
+	log.Printf("Loaded %d pending deliveries from %s", count, filepath)
+	return nil
+}
+
+// Функция для периодического сохранения очереди
+func (q *DeliveryQueue) PeriodicSave(filepath string) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := q.SaveToFile(filepath); err != nil {
+			log.Printf("Failed to save delivery queue to file: %v", err)
+		}
+	}
+}
@@ -195,7 +195,7 @@ func (r *Ranking) HandleChinaCommand(s *discordgo.Session, m *discordgo.MessageC
 	userID = strings.TrimPrefix(userID, "!")
 
 	if !r.IsAdmin(userID) {
-		s.ChannelMessageSend(m.ChannelID, "❌ Глупый Китайский мальчик хочет использовать привелегии Китай-Партии.")
+		s.ChannelMessageSend(m.ChannelID, notAdminText)
 		return
 	}
 
@@ -216,18 +216,87 @@ func (r *Ranking) HandleChinaCommand(s *discordgo.Session, m *discordgo.MessageC
 		return
 	}
 
+	response, _ := r.changeRating(userID, targetID, points, discordUserMention)
+	s.ChannelMessageSend(m.ChannelID, response)
+}
+
+// Текст отказа в командах администраторов
+const notAdminText = "❌ Глупый Китайский мальчик хочет использовать привелегии Китай-Партии."
+
+// Упоминание пользователя Discord в ответе на команду
+func discordUserMention(userID string) string {
+	return "<@" + userID + ">"
+}
+
+// Изменение рейтинга администратором. Возвращает ответ и false, если рейтинг не изменён.
+// mention выводит пользователя в ответе
+func (r *Ranking) changeRating(adminID, targetID string, points int, mention func(userID string) string) (string, bool) {
+	if !r.IsAdmin(adminID) {
+		return notAdminText, false
+	}
+
 	// Обновление рейтинга
 	r.UpdateRating(targetID, points)
 
 	// Сохранение после изменения рейтинга
-	err = r.SaveToFile("users.json")
+	err := r.SaveToFile("users.json")
 	if err != nil {
 		log.Printf("Failed to save users to file after !china command: %v", err)
-		s.ChannelMessageSend(m.ChannelID, "❌ Ничего не сохранилось.")
-		return
+		return "❌ Ничего не сохранилось.", false
+	}
+
+	return fmt.Sprintf("✅ Социальные кредиты пользователя %s изменились на %d баллов.", mention(targetID), points), true
+}
+
+// Текст топ-5 пользователей по рейтингу
+func (r *Ranking) top5Text(mention func(userID string) string) string {
+	topUsers := r.GetTop5()
+	if len(topUsers) == 0 {
+		return "Демография владельцев Социальных Кредитов пока пуста."
+	}
+	response := "Топ-5 жителей Китая:\n"
+	for i, user := range topUsers {
+		response += fmt.Sprintf("%d. %s - %d очков\n", i+1, mention(user.ID), user.Rating)
+	}
+	return response
+}
+
+// Текст рейтинга пользователя
+func (r *Ranking) ratingText(userID string, mention func(userID string) string) string {
+	return fmt.Sprintf("Социальные кредиты жителя Китая %s: %d баллов", mention(userID), r.GetRating(userID))
+}
+
+// Обработка команд рейтинга. Возвращает true, если сообщение было командой
+func (r *Ranking) HandleCommand(s *discordgo.Session, m *discordgo.MessageCreate) bool {
+	if !strings.HasPrefix(m.Content, "!") {
+		return false
+	}
+
+	if strings.HasPrefix(m.Content, "!china") {
+		r.HandleChinaCommand(s, m, m.Content)
+		return true
+	}
+
+	if m.Content == "!top5" {
+		s.ChannelMessageSend(m.ChannelID, r.top5Text(discordUserMention))
+		return true
+	}
+
+	if strings.HasPrefix(m.Content, "!rating") {
+		parts := strings.Fields(m.Content)
+		if len(parts) < 2 {
+			s.ChannelMessageSend(m.ChannelID, "❌ Глупый Китайский житель! Вводи данные из привелегии правильно! Пример: !rating @username")
+			return true
+		}
+		userID := strings.TrimPrefix(parts[1], "<@")
+		userID = strings.TrimSuffix(userID, ">") // Удаление завершающего >
+		// Удаление '!' из упоминания, если есть
+		userID = strings.TrimPrefix(userID, "!")
+		s.ChannelMessageSend(m.ChannelID, r.ratingText(userID, discordUserMention))
+		return true
 	}
 
-	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("✅ Социальные кредиты пользователя <@%s> изменились на %d баллов.", targetID, points))
+	return false
 }
 
 // Функция для отслеживания активности в голосовых каналах
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Права, которые по умолчанию нужны для команд администраторов.
+// Сервер может выдать команду другим ролям в настройках интеграции
+var rankingAdminPermissions int64 = discordgo.PermissionAdministrator
+
+// Команды рейтинга в виде команд приложения Discord
+var rankingCommands = []*discordgo.ApplicationCommand{
+	{
+		Name:                     "china",
+		Description:              "Изменить социальные кредиты жителя Китая",
+		DefaultMemberPermissions: &rankingAdminPermissions,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionUser,
+				Name:        "user",
+				Description: "Житель Китая",
+				Required:    true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "points",
+				Description: "Сколько баллов добавить, например 10 или -10",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "top5",
+		Description: "Топ-5 жителей Китая",
+	},
+	{
+		Name:        "rating",
+		Description: "Социальные кредиты жителя Китая",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionUser,
+				Name:        "user",
+				Description: "Житель Китая, по умолчанию вы",
+			},
+		},
+	},
+}
+
+// Регистрация команд рейтинга и дополнительных команд extra. Вызывается после
+// открытия сессии, когда известен ID бота
+func (r *Ranking) RegisterCommands(s *discordgo.Session, extra ...*discordgo.ApplicationCommand) error {
+	commands := append(append([]*discordgo.ApplicationCommand{}, rankingCommands...), extra...)
+	_, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, "", commands)
+	return err
+}
+
+// Обработка команд приложения для рейтинга
+func (r *Ranking) HandleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+
+	data := i.ApplicationCommandData()
+	options := make(map[string]*discordgo.ApplicationCommandInteractionDataOption)
+	for _, option := range data.Options {
+		options[option.Name] = option
+	}
+
+	switch data.Name {
+	case "china":
+		response, ok := r.changeRating(interactionUserID(i), options["user"].UserValue(nil).ID, int(options["points"].IntValue()), discordUserMention)
+		if !ok {
+			RespondEphemeral(s, i, response)
+			return
+		}
+		respond(s, i, response, 0)
+	case "top5":
+		respond(s, i, r.top5Text(discordUserMention), 0)
+	case "rating":
+		userID := interactionUserID(i)
+		if option, exists := options["user"]; exists {
+			userID = option.UserValue(nil).ID
+		}
+		respond(s, i, r.ratingText(userID, discordUserMention), 0)
+	}
+}
+
+// RespondEphemeral ответ на команду, который видит только её автор
+func RespondEphemeral(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	respond(s, i, content, discordgo.MessageFlagsEphemeral)
+}
+
+// respond ответ на команду приложения
+func respond(s *discordgo.Session, i *discordgo.InteractionCreate, content string, flags discordgo.MessageFlags) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Content: content, Flags: flags},
+	})
+	if err != nil {
+		log.Printf("Failed to respond to interaction %s: %v", i.ID, err)
+	}
+}
+
+// interactionUserID ID пользователя, вызвавшего команду, на сервере или в личных сообщениях
+func interactionUserID(i *discordgo.InteractionCreate) string {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User.ID
+	}
+	if i.User != nil {
+		return i.User.ID
+	}
+	return ""
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Команды рейтинга в меню Telegram
+var telegramRankingCommands = []tgbotapi.BotCommand{
+	{Command: "top", Description: "Топ-5 жителей Китая"},
+	{Command: "rating", Description: "Социальные кредиты жителя Китая"},
+	{Command: "china", Description: "Изменить социальные кредиты (для администраторов)"},
+}
+
+// Текст для пользователя Telegram, чей аккаунт не связан с Discord
+const notLinkedText = "❌ Житель Китая не связал аккаунт Telegram с Discord."
+
+// Структура для команд рейтинга в Telegram. Рейтинг хранится по ID Discord,
+// поэтому пользователи Telegram сопоставляются с Discord через связанные аккаунты
+type TelegramRankingCommands struct {
+	bot        *tgbotapi.BotAPI
+	ranking    *Ranking
+	identities *Identities
+	store      *MessageStore // связи пересланных сообщений, чтобы найти автора в Discord
+	// name отображаемое имя пользователя Discord для чата Telegram
+	name func(chatID, userID string) string
+}
+
+// Создание команд рейтинга для Telegram
+func NewTelegramRankingCommands(bot *tgbotapi.BotAPI, ranking *Ranking, identities *Identities, store *MessageStore, name func(chatID, userID string) string) *TelegramRankingCommands {
+	return &TelegramRankingCommands{bot: bot, ranking: ranking, identities: identities, store: store, name: name}
+}
+
+// Register регистрирует команды рейтинга и дополнительные команды extra
+// в меню Telegram через setMyCommands
+func (c *TelegramRankingCommands) Register(extra ...tgbotapi.BotCommand) error {
+	commands := append(append([]tgbotapi.BotCommand{}, telegramRankingCommands...), extra...)
+	_, err := c.bot.Request(tgbotapi.NewSetMyCommands(commands...))
+	return err
+}
+
+// Handle обрабатывает команды рейтинга. Возвращает true, если сообщение было командой
+func (c *TelegramRankingCommands) Handle(m *tgbotapi.Message) bool {
+	if !isOwnCommand(c.bot, m) {
+		return false
+	}
+
+	chatID := strconv.FormatInt(m.Chat.ID, 10)
+	mention := func(userID string) string {
+		return c.name(chatID, userID)
+	}
+	args := strings.Fields(m.CommandArguments())
+
+	switch m.Command() {
+	case "top":
+		c.reply(m, c.ranking.top5Text(mention))
+	case "rating":
+		targetID := c.target(m, args, true)
+		if targetID == "" {
+			c.reply(m, notLinkedText)
+			return true
+		}
+		c.reply(m, c.ranking.ratingText(targetID, mention))
+	case "china":
+		adminID := ""
+		if m.From != nil {
+			adminID = c.identities.DiscordID(strconv.FormatInt(m.From.ID, 10), m.From.UserName)
+		}
+		if adminID == "" || !c.ranking.IsAdmin(adminID) {
+			c.reply(m, notAdminText)
+			return true
+		}
+
+		// Пример команды: /china @username +10 или ответ на сообщение: /china +10
+		if len(args) == 0 {
+			c.reply(m, "❌ Глупый Китайский брат. Используй привелегии правильно: /china @username +10 или ответом на сообщение /china -10.")
+			return true
+		}
+		points, err := strconv.Atoi(args[len(args)-1])
+		if err != nil {
+			c.reply(m, "❌ Глупый количество очков. Используй целое число.")
+			return true
+		}
+		targetID := c.target(m, args[:len(args)-1], false)
+		if targetID == "" {
+			c.reply(m, notLinkedText)
+			return true
+		}
+		response, _ := c.ranking.changeRating(adminID, targetID, points, mention)
+		c.reply(m, response)
+	default:
+		return false
+	}
+	return true
+}
+
+// target ID пользователя Discord, к которому относится команда: упомянутого
+// в аргументах, автора сообщения, на которое ответили, или, если self, автора команды
+func (c *TelegramRankingCommands) target(m *tgbotapi.Message, args []string, self bool) string {
+	// Упоминание пользователя без имени пользователя приходит как text_mention
+	for _, entity := range m.Entities {
+		if entity.Type == "text_mention" && entity.User != nil {
+			return c.identities.DiscordID(strconv.FormatInt(entity.User.ID, 10), "")
+		}
+	}
+	if len(args) > 0 {
+		if strings.HasPrefix(args[0], "@") {
+			return c.identities.DiscordID("", args[0])
+		}
+		// ID пользователя Discord или его упоминание из Discord
+		id := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(args[0], "<@"), "!"), ">")
+		if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+			return ""
+		}
+		return id
+	}
+
+	var user *tgbotapi.User
+	switch {
+	case m.ReplyToMessage != nil:
+		// Сообщения из Discord в Telegram отправлены ботом, их автор хранится в связях
+		reply := MessageRef{Platform: PlatformTelegram, ChatID: strconv.FormatInt(m.Chat.ID, 10), ID: strconv.Itoa(m.ReplyToMessage.MessageID)}
+		if source, exists := c.store.Source(reply); exists && source.Platform == PlatformDiscord {
+			return source.Sender
+		}
+		user = m.ReplyToMessage.From
+	case self:
+		user = m.From
+	}
+	if user == nil {
+		return ""
+	}
+	return c.identities.DiscordID(strconv.FormatInt(user.ID, 10), user.UserName)
+}
+
+// reply ответ на команду в чате Telegram
+func (c *TelegramRankingCommands) reply(m *tgbotapi.Message, text string) {
+	replyTelegram(c.bot, m, text)
+}
+
+// replyTelegram ответ на сообщение в чате Telegram
+func replyTelegram(bot *tgbotapi.BotAPI, m *tgbotapi.Message, text string) {
+	msg := tgbotapi.NewMessage(m.Chat.ID, text)
+	msg.ReplyToMessageID = m.MessageID
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("Failed to reply to Telegram command in chat %d: %v", m.Chat.ID, err)
+	}
+}
+
+// isOwnCommand адресована ли команда этому боту. В группах команда может
+// быть адресована другому боту: /top@other_bot
+func isOwnCommand(bot *tgbotapi.BotAPI, m *tgbotapi.Message) bool {
+	command := m.CommandWithAt()
+	return !strings.Contains(command, "@") || strings.EqualFold(command, m.Command()+"@"+bot.Self.UserName)
+}
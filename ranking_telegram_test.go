@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestTelegramRankingTargetBridgedReply(t *testing.T) {
+	store := NewMessageStore()
+	store.Add(MessageRef{Platform: PlatformDiscord, ChatID: "c1", ID: "500", Sender: "d1"}, MessageRef{Platform: PlatformTelegram, ChatID: "-100", ID: "7"})
+	commands := &TelegramRankingCommands{identities: NewIdentities(), store: store}
+
+	bot := &tgbotapi.User{ID: 999, IsBot: true}
+	tests := []struct {
+		name  string
+		reply int
+		want  string
+	}{
+		{"bridged message", 7, "d1"},
+		{"own bot message", 8, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: -100}, ReplyToMessage: &tgbotapi.Message{MessageID: tt.reply, From: bot}}
+			if got := commands.target(m, nil, true); got != tt.want {
+				t.Errorf("target() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import "strings"
+
+// Эмодзи, которые Telegram принимает в качестве реакций (без вариационного селектора)
+var telegramReactionEmojis = map[string]bool{}
+
+func init() {
+	for _, emoji := range strings.Fields(`👍 👎 ❤ 🔥 🥰 👏 😁 🤔 🤯 😱 🤬 😢 🎉 🤩 🤮 💩 🙏 👌 🕊 🤡 🥱 🥴 😍 🐳
+		❤‍🔥 🌚 🌭 💯 🤣 ⚡ 🍌 🏆 💔 🤨 😐 🍓 🍾 💋 🖕 😈 😴 😭 🤓 👻 👨‍💻 👀 🎃 🙈 😇 😨 🤝 ✍ 🤗 🫡
+		🎅 🎄 ☃ 💅 🤪 🗿 🆒 💘 🙉 🦄 😘 💊 🙊 😎 👾 🤷‍♂ 🤷 🤷‍♀ 😡`) {
+		telegramReactionEmojis[emoji] = true
+	}
+}
+
+// normalizeEmoji убирает вариационный селектор U+FE0F, чтобы одни и те же
+// эмодзи из Discord ("❤️") и Telegram ("❤") совпадали
+func normalizeEmoji(emoji string) string {
+	return strings.ReplaceAll(emoji, "\uFE0F", "")
+}
+
+// Эмодзи, которые Discord принимает только с вариационным селектором
+var discordEmojiForms = map[string]string{
+	"❤":        "❤\uFE0F",
+	"❤\u200D🔥": "❤\uFE0F\u200D🔥",
+	"🕊":        "🕊\uFE0F",
+	"✍":        "✍\uFE0F",
+	"☃":        "☃\uFE0F",
+	"🤷\u200D♂": "🤷\u200D♂\uFE0F",
+	"🤷\u200D♀": "🤷\u200D♀\uFE0F",
+}
+
+// discordReactionEmoji возвращает эмодзи в форме, которую принимает Discord
+func discordReactionEmoji(emoji string) string {
+	if form, exists := discordEmojiForms[emoji]; exists {
+		return form
+	}
+	return emoji
+}
+
+// diffReactions возвращает реакции, которые есть в current, но нет в previous
+func diffReactions(current, previous []string) []string {
+	var diff []string
+	for _, emoji := range current {
+		found := false
+		for _, old := range previous {
+			found = found || old == emoji
+		}
+		if !found {
+			diff = append(diff, emoji)
+		}
+	}
+	return diff
+}
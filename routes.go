@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Направления пересылки для маршрута
+const (
+	DirectionBoth       = "both"
+	DirectionToTelegram = "discord_to_telegram"
+	DirectionToDiscord  = "telegram_to_discord"
+)
+
+// Действия с копией при удалении исходного сообщения
+const (
+	OnDeleteRemove = "delete" // удалить копию
+	OnDeleteMark   = "mark"   // заменить текст копии на "[deleted]"
+)
+
+// Структура для настроек оформления пересылаемых сообщений
+type RouteFormat struct {
+	// Префикс сообщений, пришедших из Discord в Telegram
+	TelegramPrefix string `json:"telegram_prefix"`
+	// Префикс сообщений, пришедших из Telegram в Discord
+	DiscordPrefix string `json:"discord_prefix"`
+	// Не указывать автора сообщения
+	HideSender bool `json:"hide_sender"`
+	// Отправлять сообщения из Telegram в Discord через вебхук от имени и с аватаром автора
+	Webhook bool `json:"webhook"`
+	// Добавлять к имени автора короткий постоянный идентификатор, чтобы различать тёзок
+	ShowSenderID bool `json:"show_sender_id"`
+}
+
+// Структура для маршрута между каналом Discord и чатом Telegram
+type Route struct {
+	DiscordChannelID string      `json:"discord_channel_id"`
+	TelegramChatID   int64       `json:"telegram_chat_id"`
+	Direction        string      `json:"direction"`
+	OnDelete         string      `json:"on_delete"`
+	Format           RouteFormat `json:"format"`
+}
+
+// Структура для конфигурации моста
+type BridgeConfig struct {
+	Routes []*Route `json:"routes"`
+}
+
+// TelegramChat возвращает ID чата Telegram в виде строки, как в Message.ChatID
+func (r *Route) TelegramChat() string {
+	return strconv.FormatInt(r.TelegramChatID, 10)
+}
+
+// ToTelegram разрешена ли пересылка из Discord в Telegram
+func (r *Route) ToTelegram() bool {
+	return r.Direction == DirectionBoth || r.Direction == DirectionToTelegram
+}
+
+// ToDiscord разрешена ли пересылка из Telegram в Discord
+func (r *Route) ToDiscord() bool {
+	return r.Direction == DirectionBoth || r.Direction == DirectionToDiscord
+}
+
+// Загрузка конфигурации моста из JSON файла
+func LoadBridgeConfig(filepath string) (*BridgeConfig, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bridge config: %v", err)
+	}
+	defer file.Close()
+
+	var config BridgeConfig
+	if err := json.NewDecoder(file).Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse bridge config: %v", err)
+	}
+
+	for i, route := range config.Routes {
+		if err := route.normalize(); err != nil {
+			return nil, fmt.Errorf("route %d: %v", i, err)
+		}
+	}
+	return &config, nil
+}
+
+// normalize проверяет маршрут и заполняет значения по умолчанию
+func (r *Route) normalize() error {
+	if r.DiscordChannelID == "" || r.TelegramChatID == 0 {
+		return fmt.Errorf("discord_channel_id and telegram_chat_id are required")
+	}
+
+	switch r.Direction {
+	case "":
+		r.Direction = DirectionBoth
+	case DirectionBoth, DirectionToTelegram, DirectionToDiscord:
+	default:
+		return fmt.Errorf("unknown direction %q", r.Direction)
+	}
+
+	switch r.OnDelete {
+	case "":
+		r.OnDelete = OnDeleteRemove
+	case OnDeleteRemove, OnDeleteMark:
+	default:
+		return fmt.Errorf("unknown on_delete action %q", r.OnDelete)
+	}
+
+	if r.Format.TelegramPrefix == "" {
+		r.Format.TelegramPrefix = "🎧:"
+	}
+	if r.Format.DiscordPrefix == "" {
+		r.Format.DiscordPrefix = "➤"
+	}
+	return nil
+}
+
+// Структура для таблицы маршрутизации
+type Routes struct {
+	byDiscord  map[string][]*Route
+	byTelegram map[string][]*Route
+}
+
+// Создание таблицы маршрутизации по списку маршрутов
+func NewRoutes(routes []*Route) *Routes {
+	table := &Routes{
+		byDiscord:  make(map[string][]*Route),
+		byTelegram: make(map[string][]*Route),
+	}
+	for _, route := range routes {
+		table.byDiscord[route.DiscordChannelID] = append(table.byDiscord[route.DiscordChannelID], route)
+		table.byTelegram[route.TelegramChat()] = append(table.byTelegram[route.TelegramChat()], route)
+	}
+	return table
+}
+
+// FromDiscord маршруты для пересылки сообщения из канала Discord
+func (t *Routes) FromDiscord(channelID string) []*Route {
+	var routes []*Route
+	for _, route := range t.byDiscord[channelID] {
+		if route.ToTelegram() {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+// FromTelegram маршруты для пересылки сообщения из чата Telegram
+func (t *Routes) FromTelegram(chatID string) []*Route {
+	var routes []*Route
+	for _, route := range t.byTelegram[chatID] {
+		if route.ToDiscord() {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+// Find ищет маршрут между каналом Discord и чатом Telegram
+func (t *Routes) Find(discordChannelID string, telegramChatID int64) *Route {
+	for _, route := range t.byDiscord[discordChannelID] {
+		if route.TelegramChatID == telegramChatID {
+			return route
+		}
+	}
+	return nil
+}
+
+// HasDiscordChannel участвует ли канал Discord хотя бы в одном маршруте
+func (t *Routes) HasDiscordChannel(channelID string) bool {
+	return len(t.byDiscord[channelID]) > 0
+}
+
+// DiscordChannel канал Discord, связанный с чатом Telegram первым маршрутом
+func (t *Routes) DiscordChannel(telegramChatID string) string {
+	if routes := t.byTelegram[telegramChatID]; len(routes) > 0 {
+		return routes[0].DiscordChannelID
+	}
+	return ""
+}
+
+// HasTelegramChat участвует ли чат Telegram хотя бы в одном маршруте
+func (t *Routes) HasTelegramChat(chatID string) bool {
+	return len(t.byTelegram[chatID]) > 0
+}
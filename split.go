@@ -0,0 +1,182 @@
+package main
+
+import "unicode/utf16"
+
+// Ограничения длины сообщений платформ
+const (
+	discordMessageLimit  = 2000 // длина текста с разметкой
+	telegramMessageLimit = 4096 // длина текста после разбора разметки
+	telegramCaptionLimit = 1024 // длина подписи вложения
+)
+
+// Структура для части длинного текста с её форматированием
+type textChunk struct {
+	Text     string
+	Entities []Entity
+}
+
+// splitText делит текст на части не длиннее limit кодовых единиц UTF-16
+// (первую не длиннее firstLimit). Текст делится по абзацам, строкам или
+// словам и по возможности не внутри кода. Форматирование, попавшее на
+// границу, продолжается в следующей части, поэтому разметка каждой части
+// остаётся правильной
+func splitText(text string, entities []Entity, firstLimit, limit int) []textChunk {
+	units := utf16.Encode([]rune(text))
+	var chunks []textChunk
+	for start := 0; ; {
+		chunkLimit := limit
+		if len(chunks) == 0 {
+			chunkLimit = firstLimit
+		}
+		chunk, next := nextChunk(units, entities, start, chunkLimit)
+		chunks = append(chunks, chunk)
+		if next >= len(units) {
+			return chunks
+		}
+		start = next
+	}
+}
+
+// nextChunk выделяет часть текста, начинающуюся со start, и возвращает её
+// вместе с началом следующей части
+func nextChunk(units []uint16, entities []Entity, start, limit int) (textChunk, int) {
+	if limit < 1 {
+		limit = 1
+	}
+
+	end := len(units)
+	next := end
+	if end-start > limit {
+		end = splitPoint(units, entities, start, start+limit)
+		next = end
+		for next < len(units) && isSplitSpace(units[next]) {
+			next++
+		}
+		for end > start && isSplitSpace(units[end-1]) {
+			end--
+		}
+	}
+
+	return textChunk{
+		Text:     string(utf16.Decode(units[start:end])),
+		Entities: clipEntities(entities, start, end),
+	}, next
+}
+
+// splitPoint выбирает место деления текста между start и limit: конец абзаца,
+// конец строки или пробел вне кода, затем конец строки внутри кода.
+// Если подходящего места нет, текст делится ровно по limit, но не внутри
+// ссылки, упоминания или суррогатной пары
+func splitPoint(units []uint16, entities []Entity, start, limit int) int {
+	// Слишком короткие части хуже, чем деление посреди слова
+	low := start + (limit-start)/4
+	candidates := []struct {
+		separator string
+		inCode    bool
+	}{
+		{"\n\n", false},
+		{"\n", false},
+		{" ", false},
+		{"\n", true},
+	}
+	for _, candidate := range candidates {
+		separator := utf16.Encode([]rune(candidate.separator))
+		for i := limit; i > low; i-- {
+			if i+len(separator) > len(units) || !hasUnits(units[i:], separator) {
+				continue
+			}
+			if candidate.inCode || !insideEntity(entities, i, isRawEntity) {
+				return i
+			}
+		}
+	}
+
+	end := limit
+	for _, entity := range entities {
+		if (entity.Type == EntityURL || entity.Type == EntityMention) &&
+			entity.Offset > start && entity.Offset < end && entity.Offset+entity.Length > end {
+			end = entity.Offset
+		}
+	}
+	if end > start+1 && utf16.IsSurrogate(rune(units[end-1])) && units[end-1] < 0xDC00 {
+		end--
+	}
+	return end
+}
+
+// hasUnits начинается ли units с prefix
+func hasUnits(units, prefix []uint16) bool {
+	for i, unit := range prefix {
+		if units[i] != unit {
+			return false
+		}
+	}
+	return true
+}
+
+// insideEntity находится ли позиция строго внутри форматирования, для которого match возвращает true
+func insideEntity(entities []Entity, pos int, match func(Entity) bool) bool {
+	for _, entity := range entities {
+		if match(entity) && entity.Offset < pos && pos < entity.Offset+entity.Length {
+			return true
+		}
+	}
+	return false
+}
+
+// isSplitSpace отбрасывается ли символ на границе частей
+func isSplitSpace(unit uint16) bool {
+	return unit == ' ' || unit == '\n'
+}
+
+// clipEntities возвращает форматирование участка текста [start, end)
+// со смещениями относительно его начала
+func clipEntities(entities []Entity, start, end int) []Entity {
+	var clipped []Entity
+	for _, entity := range entities {
+		from, to := entity.Offset, entity.Offset+entity.Length
+		if from < start {
+			from = start
+		}
+		if to > end {
+			to = end
+		}
+		if to > from {
+			entity.Offset = from - start
+			entity.Length = to - from
+			clipped = append(clipped, entity)
+		}
+	}
+	return clipped
+}
+
+// splitRendered делит текст на части и выводит их через render так, чтобы
+// длина каждой части вместе с разметкой не превышала ограничение. Нужна для
+// платформ, которые считают длину сообщения с разметкой, как Discord
+func splitRendered(text string, entities []Entity, firstLimit, limit int, render func(string, []Entity) string) []string {
+	units := utf16.Encode([]rune(text))
+	var rendered []string
+	for start := 0; ; {
+		chunkLimit := limit
+		if len(rendered) == 0 {
+			chunkLimit = firstLimit
+		}
+
+		// Разметка и экранирование удлиняют текст: если часть не уместилась,
+		// берём её короче пропорционально
+		plainLimit := chunkLimit
+		chunk, next := nextChunk(units, entities, start, plainLimit)
+		output := render(chunk.Text, chunk.Entities)
+		for length := utf16Len(output); length > chunkLimit && plainLimit > 1; length = utf16Len(output) {
+			plainLimit = plainLimit * chunkLimit / length
+			chunk, next = nextChunk(units, entities, start, plainLimit)
+			output = render(chunk.Text, chunk.Entities)
+		}
+
+		rendered = append(rendered, output)
+		if next >= len(units) {
+			return rendered
+		}
+		start = next
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		entities   []Entity
+		firstLimit int
+		limit      int
+		want       []textChunk
+	}{
+		{"short", "hello", nil, 10, 10, []textChunk{{Text: "hello"}}},
+		{"paragraph", "aaaa\n\nbbbb", nil, 6, 6, []textChunk{{Text: "aaaa"}, {Text: "bbbb"}}},
+		{"word", "hello world foo", nil, 11, 11, []textChunk{{Text: "hello world"}, {Text: "foo"}}},
+		{"first limit", "aa bb cc", nil, 2, 5, []textChunk{{Text: "aa"}, {Text: "bb cc"}}},
+		{"entity continues", "bold text", []Entity{{Type: EntityBold, Offset: 0, Length: 9}}, 5, 5, []textChunk{
+			{Text: "bold", Entities: []Entity{{Type: EntityBold, Offset: 0, Length: 4}}},
+			{Text: "text", Entities: []Entity{{Type: EntityBold, Offset: 0, Length: 4}}},
+		}},
+		{"surrogate pairs", "😀😀😀", nil, 3, 3, []textChunk{{Text: "😀"}, {Text: "😀"}, {Text: "😀"}}},
+		{"newline in code", "line1\nline2", []Entity{{Type: EntityPre, Offset: 0, Length: 11}}, 8, 8, []textChunk{
+			{Text: "line1", Entities: []Entity{{Type: EntityPre, Offset: 0, Length: 5}}},
+			{Text: "line2", Entities: []Entity{{Type: EntityPre, Offset: 0, Length: 5}}},
+		}},
+		{"space in code", "x = `a b`", []Entity{{Type: EntityCode, Offset: 4, Length: 5}}, 8, 8, []textChunk{
+			{Text: "x ="},
+			{Text: "`a b`", Entities: []Entity{{Type: EntityCode, Offset: 0, Length: 5}}},
+		}},
+		{"url", "go https://example.com now", []Entity{{Type: EntityURL, Offset: 3, Length: 19}}, 10, 10, []textChunk{
+			{Text: "go"},
+			{Text: "https://ex", Entities: []Entity{{Type: EntityURL, Offset: 0, Length: 10}}},
+			{Text: "ample.com", Entities: []Entity{{Type: EntityURL, Offset: 0, Length: 9}}},
+			{Text: "now"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitText(tt.text, tt.entities, tt.firstLimit, tt.limit)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitText() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitRendered(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		limit    int
+		maxParts int
+	}{
+		{"escaping", strings.Repeat("a*b_c ", 20), 20, 12},
+		{"markup", strings.Repeat("**bold** and *italic* ", 10), 30, 12},
+		{"emoji", strings.Repeat("😀 ", 30), 10, 15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := parseDiscordMarkdown(tt.src, nil)
+			parts := splitRendered(text, entities, tt.limit, tt.limit, renderDiscordMarkdown)
+			if len(parts) > tt.maxParts {
+				t.Errorf("got %d parts, want at most %d", len(parts), tt.maxParts)
+			}
+			var words []string
+			for _, part := range parts {
+				if length := utf16Len(part); length > tt.limit {
+					t.Errorf("part %q has length %d, limit %d", part, length, tt.limit)
+				}
+				plain, _ := parseDiscordMarkdown(part, nil)
+				words = append(words, strings.Fields(plain)...)
+			}
+			if want := strings.Fields(text); !reflect.DeepEqual(words, want) {
+				t.Errorf("parts %q lost text", parts)
+			}
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Типы пересланных копий сообщения
+const (
+	CopyText    = "text"    // текстовое сообщение
+	CopyCaption = "caption" // вложение, подпись которого содержит текст исходного сообщения
+	CopyFile    = "file"    // вложение без текста исходного сообщения
+	CopyPart    = "part"    // продолжение длинного текста отдельным сообщением
+)
+
+// Сколько хранить связи между сообщениями
+const messageLinkTTL = 7 * 24 * time.Hour
+
+// Структура для ссылки на сообщение на одной из платформ
+type MessageRef struct {
+	Platform string `json:"platform"`
+	ChatID   string `json:"chat_id"`
+	ID       string `json:"id"`
+	Kind     string `json:"kind,omitempty"`
+	// Ветка или тема, в которой находится сообщение. В ключ не входит:
+	// ID сообщений уникальны в пределах чата
+	Thread string `json:"thread,omitempty"`
+	// ID автора. Нужен, чтобы по копии найти автора исходного сообщения
+	Sender string `json:"sender,omitempty"`
+}
+
+// Key возвращает ключ сообщения для хранилища
+func (ref MessageRef) Key() string {
+	return ref.Platform + ":" + ref.ChatID + ":" + ref.ID
+}
+
+// RefOf возвращает ссылку на входящее сообщение
+func RefOf(msg *Message) MessageRef {
+	return MessageRef{Platform: msg.Platform, ChatID: msg.ChatID, ID: msg.ID, Thread: msg.ThreadID, Sender: msg.Sender.ID}
+}
+
+// Структура для связи исходного сообщения с его копиями на другой платформе
+type MessageLink struct {
+	Source  MessageRef   `json:"source"`
+	Copies  []MessageRef `json:"copies"`
+	Created int64        `json:"created"`
+	// Число реакций по платформе, на которой они поставлены, и чату, в который
+	// они пересылаются: "платформа>чат" -> эмодзи -> число
+	Reactions map[string]map[string]int `json:"reactions,omitempty"`
+}
+
+// Структура для хранилища связей исходных и пересланных сообщений
+type MessageStore struct {
+	mu         sync.Mutex
+	links      map[string]*MessageLink
+	sources    map[string]string // ключ копии -> ключ исходного сообщения
+	isModified bool              // Флаг, который указывает на изменения
+}
+
+// Создание пустого хранилища сообщений
+func NewMessageStore() *MessageStore {
+	return &MessageStore{
+		links:   make(map[string]*MessageLink),
+		sources: make(map[string]string),
+	}
+}
+
+// Add сохраняет копию исходного сообщения
+func (s *MessageStore) Add(source MessageRef, bridged MessageRef) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, exists := s.links[source.Key()]
+	if !exists {
+		link = &MessageLink{Source: source, Created: time.Now().Unix()}
+		s.links[source.Key()] = link
+	}
+	link.Copies = append(link.Copies, bridged)
+	s.sources[bridged.Key()] = source.Key()
+	s.isModified = true
+}
+
+// Copies возвращает все копии исходного сообщения
+func (s *MessageStore) Copies(source MessageRef) []MessageRef {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, exists := s.links[source.Key()]
+	if !exists {
+		return nil
+	}
+	copies := make([]MessageRef, len(link.Copies))
+	copy(copies, link.Copies)
+	return copies
+}
+
+// Mirror ищет сообщение в чате chatID платформы platform, которое связано с ref:
+// копию исходного сообщения ref, исходное сообщение копии ref или другую копию
+// того же исходного сообщения. Возвращает пустую ссылку, если связи нет
+func (s *MessageStore) Mirror(ref MessageRef, platform, chatID string) MessageRef {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, exists := s.link(ref)
+	if !exists {
+		return MessageRef{}
+	}
+
+	if link.Source.Platform == platform && link.Source.ChatID == chatID {
+		return link.Source
+	}
+	for _, bridged := range link.Copies {
+		if bridged.Platform == platform && bridged.ChatID == chatID {
+			return bridged
+		}
+	}
+	return MessageRef{}
+}
+
+// Source возвращает исходное сообщение, копией которого является ref
+func (s *MessageStore) Source(ref MessageRef) (MessageRef, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, exists := s.links[s.sources[ref.Key()]]
+	if !exists {
+		return MessageRef{}, false
+	}
+	return link.Source, true
+}
+
+// link ищет связь по исходному сообщению или по его копии. Вызывается под блокировкой
+func (s *MessageStore) link(ref MessageRef) (*MessageLink, bool) {
+	link, exists := s.links[ref.Key()]
+	if !exists {
+		link, exists = s.links[s.sources[ref.Key()]]
+	}
+	return link, exists
+}
+
+// React учитывает изменение реакций на сообщение ref или его копию для
+// пересылки в чат target. Реакции считаются отдельно для каждого чата
+// назначения, потому что каждый маршрут доставляет их своей задачей.
+// Возвращает false, если сообщение не пересылалось
+func (s *MessageStore) React(ref MessageRef, target string, added, removed []string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, exists := s.link(ref)
+	if !exists {
+		return false
+	}
+
+	if link.Reactions == nil {
+		link.Reactions = make(map[string]map[string]int)
+	}
+	key := ref.Platform + ">" + target
+	counts := link.Reactions[key]
+	if counts == nil {
+		counts = make(map[string]int)
+		link.Reactions[key] = counts
+	}
+	for _, emoji := range added {
+		counts[emoji]++
+	}
+	for _, emoji := range removed {
+		// После перезапуска счётчик может не знать о старых реакциях
+		if counts[emoji] <= 1 {
+			delete(counts, emoji)
+		} else {
+			counts[emoji]--
+		}
+	}
+	s.isModified = true
+	return true
+}
+
+// Reactions возвращает реакции на сообщение ref, поставленные на его платформе
+// для пересылки в чат target, отсортированные по убыванию числа
+func (s *MessageStore) Reactions(ref MessageRef, target string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, exists := s.link(ref)
+	if !exists {
+		return nil
+	}
+	counts := link.Reactions[ref.Platform+">"+target]
+
+	emojis := make([]string, 0, len(counts))
+	for emoji := range counts {
+		emojis = append(emojis, emoji)
+	}
+	sort.Slice(emojis, func(i, j int) bool {
+		if counts[emojis[i]] != counts[emojis[j]] {
+			return counts[emojis[i]] > counts[emojis[j]]
+		}
+		return emojis[i] < emojis[j]
+	})
+	return emojis
+}
+
+// RemoveCopy удаляет копию исходного сообщения. Связь без копий удаляется целиком
+func (s *MessageStore) RemoveCopy(source MessageRef, bridged MessageRef) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, exists := s.links[source.Key()]
+	if !exists {
+		return
+	}
+	for i, existing := range link.Copies {
+		if existing.Key() == bridged.Key() {
+			link.Copies = append(link.Copies[:i], link.Copies[i+1:]...)
+			break
+		}
+	}
+	delete(s.sources, bridged.Key())
+	if len(link.Copies) == 0 {
+		delete(s.links, source.Key())
+	}
+	s.isModified = true
+}
+
+// removeLink удаляет связь и её обратные ссылки. Вызывается под блокировкой
+func (s *MessageStore) removeLink(link *MessageLink) {
+	for _, bridged := range link.Copies {
+		delete(s.sources, bridged.Key())
+	}
+	delete(s.links, link.Source.Key())
+	s.isModified = true
+}
+
+// prune удаляет устаревшие связи. Вызывается под блокировкой
+func (s *MessageStore) prune() {
+	deadline := time.Now().Add(-messageLinkTTL).Unix()
+	for _, link := range s.links {
+		if link.Created < deadline {
+			s.removeLink(link)
+		}
+	}
+}
+
+// Сохранение связей в файл
+func (s *MessageStore) SaveToFile(filepath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune()
+
+	// Если изменений не было, не сохраняем файл
+	if !s.isModified {
+		return nil
+	}
+
+	file, err := os.Create(filepath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+	defer file.Close()
+
+	if err := json.NewEncoder(file).Encode(s.links); err != nil {
+		return fmt.Errorf("failed to encode message links: %v", err)
+	}
+
+	s.isModified = false
+	return nil
+}
+
+// Загрузка связей из файла
+func (s *MessageStore) LoadFromFile(filepath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.Open(filepath)
+	if err != nil {
+		// Если файл не существует, не считаем это ошибкой
+		if os.IsNotExist(err) {
+			log.Printf("File %s does not exist. Starting with empty message links.", filepath)
+			return nil
+		}
+		return fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&s.links); err != nil {
+		return fmt.Errorf("failed to decode message links: %v", err)
+	}
+	for key, link := range s.links {
+		for _, bridged := range link.Copies {
+			s.sources[bridged.Key()] = key
+		}
+	}
+
+	log.Printf("Loaded %d message links from %s", len(s.links), filepath)
+	return nil
+}
+
+// Функция для периодического сохранения связей
+func (s *MessageStore) PeriodicSave(filepath string) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.SaveToFile(filepath); err != nil {
+			log.Printf("Failed to save message links to file: %v", err)
+		}
+	}
+}
@@ -0,0 +1,763 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// TelegramCommandHandler обработчик команд Telegram. Возвращает true, если
+// сообщение было командой и не должно уходить в мост
+type TelegramCommandHandler func(m *tgbotapi.Message) bool
+
+// Структура для платформы Telegram поверх tgbotapi
+type TelegramPlatform struct {
+	bot      *tgbotapi.BotAPI
+	messages chan *Message
+	commands TelegramCommandHandler
+
+	groupsMu sync.Mutex
+	groups   map[string]*Message // альбомы, ожидающие остальных вложений
+
+	avatars *AvatarServer
+}
+
+// Сколько ждать остальные сообщения альбома после первого
+const mediaGroupWindow = 1500 * time.Millisecond
+
+// Создание платформы Telegram
+func NewTelegramPlatform(bot *tgbotapi.BotAPI) *TelegramPlatform {
+	return &TelegramPlatform{
+		bot:      bot,
+		messages: make(chan *Message, 100),
+		groups:   make(map[string]*Message),
+	}
+}
+
+// SetAvatars задаёт сервер, через который отдаются аватары отправителей
+func (t *TelegramPlatform) SetAvatars(avatars *AvatarServer) {
+	t.avatars = avatars
+}
+
+// SetCommandHandler задаёт обработчик команд, который вызывается до моста
+func (t *TelegramPlatform) SetCommandHandler(handler TelegramCommandHandler) {
+	t.commands = handler
+}
+
+func (t *TelegramPlatform) Name() string {
+	return PlatformTelegram
+}
+
+func (t *TelegramPlatform) Messages() <-chan *Message {
+	return t.messages
+}
+
+// Виды обновлений, которые запрашиваются у Telegram
+var telegramAllowedUpdates = []string{"message", "edited_message", "message_reaction"}
+
+// Структура для обновления Telegram с полями, которых нет в tgbotapi
+type telegramUpdate struct {
+	tgbotapi.Update
+	MessageReaction *telegramReactionUpdate `json:"message_reaction,omitempty"`
+
+	// Сведения о темах форума для Message и EditedMessage
+	MessageTopic       *telegramTopic `json:"-"`
+	EditedMessageTopic *telegramTopic `json:"-"`
+}
+
+// Структура для полей сообщения о теме форума, которых нет в tgbotapi
+type telegramTopic struct {
+	ThreadID          int                 `json:"message_thread_id"`
+	IsTopicMessage    bool                `json:"is_topic_message"`
+	ForumTopicCreated *telegramForumTopic `json:"forum_topic_created,omitempty"`
+	ReplyToMessage    *struct {
+		ForumTopicCreated *telegramForumTopic `json:"forum_topic_created,omitempty"`
+	} `json:"reply_to_message,omitempty"`
+}
+
+// Структура для темы форума Telegram
+type telegramForumTopic struct {
+	ThreadID int    `json:"message_thread_id,omitempty"`
+	Name     string `json:"name"`
+}
+
+// UnmarshalJSON разбирает обновление вместе с полями тем форума, которые
+// tgbotapi пропускает
+func (u *telegramUpdate) UnmarshalJSON(data []byte) error {
+	type plainUpdate telegramUpdate
+	if err := json.Unmarshal(data, (*plainUpdate)(u)); err != nil {
+		return err
+	}
+
+	var topics struct {
+		Message       *telegramTopic `json:"message"`
+		EditedMessage *telegramTopic `json:"edited_message"`
+	}
+	if err := json.Unmarshal(data, &topics); err != nil {
+		return err
+	}
+	u.MessageTopic, u.EditedMessageTopic = topics.Message, topics.EditedMessage
+	return nil
+}
+
+// name название темы. Telegram присылает его только в первом сообщении темы,
+// на которое отвечают сообщения темы без явного ответа. Если названия нет,
+// тема называется по номеру
+func (topic *telegramTopic) name() string {
+	switch {
+	case topic.ForumTopicCreated != nil:
+		return topic.ForumTopicCreated.Name
+	case topic.ReplyToMessage != nil && topic.ReplyToMessage.ForumTopicCreated != nil:
+		return topic.ReplyToMessage.ForumTopicCreated.Name
+	}
+	return fmt.Sprintf("Тема %d", topic.ThreadID)
+}
+
+// Структура для изменения реакций пользователя на сообщение
+type telegramReactionUpdate struct {
+	Chat        tgbotapi.Chat      `json:"chat"`
+	MessageID   int                `json:"message_id"`
+	User        *tgbotapi.User     `json:"user,omitempty"`
+	ActorChat   *tgbotapi.Chat     `json:"actor_chat,omitempty"` // для анонимных реакций от имени чата
+	OldReaction []telegramReaction `json:"old_reaction"`
+	NewReaction []telegramReaction `json:"new_reaction"`
+}
+
+// Структура для реакции Telegram
+type telegramReaction struct {
+	Type  string `json:"type"`
+	Emoji string `json:"emoji,omitempty"`
+}
+
+// Start запускает получение обновлений Telegram через long polling.
+// Bot API не присылает событий об удалении сообщений, поэтому удаления
+// из Telegram через мост не передаются
+func (t *TelegramPlatform) Start() {
+	go func() {
+		offset := 0
+		for {
+			updates, err := t.getUpdates(offset)
+			if err != nil {
+				log.Printf("Failed to get updates from Telegram: %v", err)
+				time.Sleep(3 * time.Second)
+				continue
+			}
+			for _, update := range updates {
+				offset = update.UpdateID + 1
+				t.handleUpdate(update)
+			}
+		}
+	}()
+}
+
+// getUpdates запрашивает обновления напрямую, так как tgbotapi не умеет
+// запрашивать и разбирать реакции
+func (t *TelegramPlatform) getUpdates(offset int) ([]telegramUpdate, error) {
+	params := tgbotapi.Params{}
+	params.AddNonZero("offset", offset)
+	params.AddNonZero("timeout", 60)
+	if err := params.AddInterface("allowed_updates", telegramAllowedUpdates); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.bot.MakeRequest("getUpdates", params)
+	if err != nil {
+		return nil, err
+	}
+	var updates []telegramUpdate
+	if err := json.Unmarshal(resp.Result, &updates); err != nil {
+		return nil, fmt.Errorf("failed to decode updates: %v", err)
+	}
+	return updates, nil
+}
+
+// handleUpdate преобразует обновление Telegram и передаёт его в мост
+func (t *TelegramPlatform) handleUpdate(update telegramUpdate) {
+	switch {
+	case update.Message != nil && update.Message.IsCommand() && t.commands != nil && t.commands(update.Message):
+	case update.Message != nil && update.Message.MediaGroupID != "":
+		t.bufferMediaGroup(update.Message.MediaGroupID, t.normalize(update.Message, update.MessageTopic, MessageCreated))
+	case update.Message != nil:
+		t.messages <- t.normalize(update.Message, update.MessageTopic, MessageCreated)
+	case update.EditedMessage != nil:
+		t.messages <- t.normalize(update.EditedMessage, update.EditedMessageTopic, MessageEdited)
+	case update.MessageReaction != nil:
+		if msg := t.normalizeReaction(update.MessageReaction); msg != nil {
+			t.messages <- msg
+		}
+	}
+}
+
+// normalizeReaction преобразует изменение реакций в сообщение MessageReacted.
+// Реакции самого бота и собственные эмодзи Telegram пропускаются
+func (t *TelegramPlatform) normalizeReaction(r *telegramReactionUpdate) *Message {
+	if r.User != nil && r.User.ID == t.bot.Self.ID {
+		return nil
+	}
+
+	emojis := func(reactions []telegramReaction) []string {
+		var result []string
+		for _, reaction := range reactions {
+			if reaction.Type == "emoji" {
+				result = append(result, normalizeEmoji(reaction.Emoji))
+			}
+		}
+		return result
+	}
+	oldEmojis, newEmojis := emojis(r.OldReaction), emojis(r.NewReaction)
+
+	msg := &Message{
+		Kind:             MessageReacted,
+		Platform:         PlatformTelegram,
+		ChatID:           strconv.FormatInt(r.Chat.ID, 10),
+		ID:               strconv.Itoa(r.MessageID),
+		ReactionsAdded:   diffReactions(newEmojis, oldEmojis),
+		ReactionsRemoved: diffReactions(oldEmojis, newEmojis),
+	}
+	switch {
+	case r.User != nil:
+		msg.Sender = telegramUserSender(r.User)
+	case r.ActorChat != nil:
+		msg.Sender = telegramChatSender(r.ActorChat, "")
+	}
+	if len(msg.ReactionsAdded) == 0 && len(msg.ReactionsRemoved) == 0 {
+		return nil
+	}
+	return msg
+}
+
+// telegramSender определяет автора сообщения. Сообщения от имени чата (посты
+// канала и сообщения анонимных администраторов) приходят с SenderChat, а From
+// в них служебный или отсутствует
+func telegramSender(m *tgbotapi.Message) Sender {
+	switch {
+	case m.SenderChat != nil:
+		return telegramChatSender(m.SenderChat, m.AuthorSignature)
+	case m.From != nil:
+		return telegramUserSender(m.From)
+	}
+	return Sender{}
+}
+
+// telegramUserSender автор-пользователь. Имя пользователя есть не у всех,
+// поэтому отображаемое имя составляется из имени и фамилии
+func telegramUserSender(u *tgbotapi.User) Sender {
+	name := strings.TrimSpace(u.FirstName + " " + u.LastName)
+	if name == "" {
+		name = u.UserName
+	}
+	return Sender{ID: strconv.FormatInt(u.ID, 10), Username: u.UserName, Name: name}
+}
+
+// telegramChatSender автор-чат. signature подпись автора поста или должность
+// анонимного администратора, если она указана
+func telegramChatSender(chat *tgbotapi.Chat, signature string) Sender {
+	name := chat.Title
+	if signature != "" {
+		name = fmt.Sprintf("%s (%s)", signature, chat.Title)
+	}
+	return Sender{ID: strconv.FormatInt(chat.ID, 10), Username: chat.UserName, Name: name}
+}
+
+// bufferMediaGroup собирает сообщения одного альбома в одно сообщение.
+// Telegram присылает каждое вложение альбома отдельным обновлением с общим
+// MediaGroupID, поэтому альбом отправляется в мост через mediaGroupWindow
+// после первого вложения
+func (t *TelegramPlatform) bufferMediaGroup(groupID string, msg *Message) {
+	t.groupsMu.Lock()
+	defer t.groupsMu.Unlock()
+
+	group, exists := t.groups[groupID]
+	if !exists {
+		t.groups[groupID] = msg
+		time.AfterFunc(mediaGroupWindow, func() {
+			t.groupsMu.Lock()
+			group := t.groups[groupID]
+			delete(t.groups, groupID)
+			t.groupsMu.Unlock()
+
+			t.messages <- group
+		})
+		return
+	}
+
+	group.Attachments = append(group.Attachments, msg.Attachments...)
+	// Подпись альбома хранится в одном из сообщений, его ID и считаем ID альбома
+	if group.Text == "" && msg.Text != "" {
+		group.ID = msg.ID
+		group.Text = msg.Text
+		group.Entities = msg.Entities
+	}
+}
+
+// normalize преобразует сообщение Telegram в нормализованное сообщение.
+// topic сведения о теме форума, nil если их нет
+func (t *TelegramPlatform) normalize(m *tgbotapi.Message, topic *telegramTopic, kind int) *Message {
+	msg := &Message{
+		Kind:     kind,
+		Platform: PlatformTelegram,
+		ChatID:   strconv.FormatInt(m.Chat.ID, 10),
+		ID:       strconv.Itoa(m.MessageID),
+		Sender:   telegramSender(m),
+		Text:     m.Text,
+		Entities: telegramEntities(m.Entities),
+	}
+	// Фотографии профиля есть только у пользователей, а не у чатов
+	if t.avatars != nil && m.SenderChat == nil && m.From != nil {
+		msg.Sender.AvatarURL = t.avatars.URL(msg.Sender.ID)
+	}
+	// message_thread_id есть и у ответов в обычных группах, тема только при is_topic_message
+	if topic != nil && topic.IsTopicMessage {
+		msg.ThreadID = strconv.Itoa(topic.ThreadID)
+		msg.ThreadName = topic.name()
+	}
+
+	// Сообщения темы без явного ответа приходят ответом на её первое сообщение
+	if reply := m.ReplyToMessage; reply != nil && strconv.Itoa(reply.MessageID) != msg.ThreadID {
+		msg.ReplyTo = &ReplyInfo{ID: strconv.Itoa(reply.MessageID), Text: reply.Text}
+		if reply.Text == "" {
+			msg.ReplyTo.Text = reply.Caption
+		}
+		msg.ReplyTo.Sender = telegramSender(reply)
+	}
+
+	// У сообщений с вложениями текст хранится в подписи
+	if msg.Text == "" {
+		msg.Text = m.Caption
+		msg.Entities = telegramEntities(m.CaptionEntities)
+	}
+
+	// При редактировании меняется только текст, вложения уже пересланы
+	if kind == MessageEdited {
+		return msg
+	}
+
+	// Вложения и прочие виды сообщений
+	t.addMedia(msg, m)
+
+	return msg
+}
+
+// telegramEntities преобразует форматирование Telegram. Неподдерживаемые
+// виды (хэштеги, команды и т.п.) отбрасываются
+func telegramEntities(entities []tgbotapi.MessageEntity) []Entity {
+	var result []Entity
+	for _, entity := range entities {
+		switch entity.Type {
+		case EntityBold, EntityItalic, EntityUnderline, EntityStrikethrough, EntitySpoiler,
+			EntityCode, EntityPre, EntityTextLink, EntityURL:
+			result = append(result, Entity{
+				Type:     entity.Type,
+				Offset:   entity.Offset,
+				Length:   entity.Length,
+				URL:      entity.URL,
+				Language: entity.Language,
+			})
+		case "mention":
+			result = append(result, Entity{Type: EntityMention, Offset: entity.Offset, Length: entity.Length})
+		case "text_mention":
+			// Упоминание пользователя без имени пользователя
+			mention := Entity{Type: EntityMention, Offset: entity.Offset, Length: entity.Length}
+			if entity.User != nil {
+				mention.UserID = strconv.FormatInt(entity.User.ID, 10)
+			}
+			result = append(result, mention)
+		}
+	}
+	return result
+}
+
+// SendText отправка текста в чат Telegram. Текст должен быть в формате MarkdownV2
+func (t *TelegramPlatform) SendText(chatID, text string, opts SendOptions) (string, error) {
+	id, err := parseChatID(chatID)
+	if err != nil {
+		return "", fmt.Errorf("invalid chat ID %q: %v", chatID, err)
+	}
+
+	telegramMsg := tgbotapi.NewMessage(id, text)
+	telegramMsg.ParseMode = "MarkdownV2"
+	applySendOptions(&telegramMsg.BaseChat, opts)
+	sent, err := t.bot.Send(telegramMsg)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(sent.MessageID), nil
+}
+
+// Ограничения Telegram на размер файлов
+const (
+	telegramURLPhotoLimit    = 5 << 20  // фото, отправляемое по ссылке
+	telegramURLFileLimit     = 20 << 20 // остальные файлы, отправляемые по ссылке
+	telegramUploadPhotoLimit = 10 << 20 // загружаемое фото
+	telegramUploadLimit      = 50 << 20 // остальные загружаемые файлы
+	telegramDownloadLimit    = 20 << 20 // файлы, которые бот может скачать через getFile
+)
+
+// Способы отправки вложений в Telegram
+const (
+	telegramPhoto     = "photo"
+	telegramAnimation = "animation"
+	telegramVideo     = "video"
+	telegramVoice     = "voice"
+	telegramAudio     = "audio"
+	telegramDocument  = "document"
+)
+
+// fitsTelegram можно ли отправить вложение в Telegram файлом.
+// Более крупные вложения пересылаются ссылкой
+func fitsTelegram(file *Attachment) bool {
+	return file.Size <= telegramUploadLimit
+}
+
+// downloadable можно ли скачать вложение. Файлы Telegram больше
+// telegramDownloadLimit Bot API не отдаёт, вместо них пересылается описание
+func downloadable(file *Attachment) bool {
+	return file.FileID == "" || file.Size <= telegramDownloadLimit
+}
+
+// telegramMediaKind выбирает метод Telegram для вложения по его типу и размеру
+func telegramMediaKind(file *Attachment) string {
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(file.Name))
+	}
+
+	switch {
+	// Голосовым сообщением отправляется только голосовое сообщение Discord,
+	// остальные файлы Ogg остаются аудиофайлами
+	case file.Voice:
+		return telegramVoice
+	case contentType == "image/gif":
+		return telegramAnimation
+	case strings.HasPrefix(contentType, "image/"):
+		// Крупные изображения Telegram принимает только как документ
+		if file.Size > telegramUploadPhotoLimit {
+			return telegramDocument
+		}
+		return telegramPhoto
+	case strings.HasPrefix(contentType, "video/"):
+		return telegramVideo
+	case strings.HasPrefix(contentType, "audio/"):
+		return telegramAudio
+	default:
+		return telegramDocument
+	}
+}
+
+// SendFiles отправка вложений в чат Telegram по одному. Подпись получает первое
+// успешно отправленное вложение, ошибка отправки остальных не прерывает
+func (t *TelegramPlatform) SendFiles(chatID string, files []*Attachment, caption string, opts SendOptions) ([]string, error) {
+	var ids []string
+	var lastErr error
+	for _, file := range files {
+		id, err := t.sendFile(chatID, file, caption, opts)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		ids = append(ids, id)
+		caption = ""
+		opts = SendOptions{ThreadID: opts.ThreadID}
+	}
+	return ids, lastErr
+}
+
+// sendFile отправка вложения в чат Telegram методом, подходящим для его типа
+func (t *TelegramPlatform) sendFile(chatID string, file *Attachment, caption string, opts SendOptions) (string, error) {
+	id, err := parseChatID(chatID)
+	if err != nil {
+		return "", fmt.Errorf("invalid chat ID %q: %v", chatID, err)
+	}
+	if !fitsTelegram(file) {
+		return "", fmt.Errorf("file %s is too large for Telegram: %d bytes", file.Name, file.Size)
+	}
+
+	kind := telegramMediaKind(file)
+	data, err := telegramFileData(file, kind)
+	if err != nil {
+		return "", err
+	}
+	// Ответ сервера с содержимым файла закрывается после загрузки в Telegram
+	if reader, ok := data.(tgbotapi.FileReader); ok {
+		if closer, ok := reader.Reader.(io.Closer); ok {
+			defer closer.Close()
+		}
+	}
+
+	if _, ok := telegramSpoilerMedia[kind]; ok && file.Spoiler {
+		return t.sendSpoiler(id, kind, data, caption, opts)
+	}
+
+	var config tgbotapi.Chattable
+	switch kind {
+	case telegramPhoto:
+		photo := tgbotapi.NewPhoto(id, data)
+		photo.Caption = caption
+		applySendOptions(&photo.BaseChat, opts)
+		config = photo
+	case telegramAnimation:
+		animation := tgbotapi.NewAnimation(id, data)
+		animation.Caption = caption
+		applySendOptions(&animation.BaseChat, opts)
+		config = animation
+	case telegramVideo:
+		video := tgbotapi.NewVideo(id, data)
+		video.Caption = caption
+		video.SupportsStreaming = true
+		applySendOptions(&video.BaseChat, opts)
+		config = video
+	case telegramVoice:
+		voice := tgbotapi.NewVoice(id, data)
+		voice.Caption = caption
+		applySendOptions(&voice.BaseChat, opts)
+		config = voice
+	case telegramAudio:
+		audio := tgbotapi.NewAudio(id, data)
+		audio.Caption = caption
+		applySendOptions(&audio.BaseChat, opts)
+		config = audio
+	default:
+		document := tgbotapi.NewDocument(id, data)
+		document.Caption = caption
+		applySendOptions(&document.BaseChat, opts)
+		config = document
+	}
+
+	sent, err := t.bot.Send(config)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(sent.MessageID), nil
+}
+
+// Метод и поле запроса Telegram для вложений, которые можно скрыть под спойлер
+var telegramSpoilerMedia = map[string][2]string{
+	telegramPhoto:     {"sendPhoto", "photo"},
+	telegramAnimation: {"sendAnimation", "animation"},
+	telegramVideo:     {"sendVideo", "video"},
+}
+
+// sendSpoiler отправка вложения под спойлером. tgbotapi не поддерживает
+// has_spoiler, поэтому запрос собирается вручную
+func (t *TelegramPlatform) sendSpoiler(chatID int64, kind string, data tgbotapi.RequestFileData, caption string, opts SendOptions) (string, error) {
+	method, field := telegramSpoilerMedia[kind][0], telegramSpoilerMedia[kind][1]
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", chatID)
+	params.AddNonEmpty("caption", caption)
+	params.AddBool("has_spoiler", true)
+	params.AddNonEmpty("message_thread_id", opts.ThreadID)
+	if replyID, err := strconv.Atoi(opts.ReplyTo); err == nil {
+		params.AddNonZero("reply_to_message_id", replyID)
+		params.AddBool("allow_sending_without_reply", true)
+	}
+
+	var resp *tgbotapi.APIResponse
+	var err error
+	if data.NeedsUpload() {
+		resp, err = t.bot.UploadFiles(method, params, []tgbotapi.RequestFile{{Name: field, Data: data}})
+	} else {
+		params[field] = data.SendData()
+		resp, err = t.bot.MakeRequest(method, params)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var sent tgbotapi.Message
+	if err := json.Unmarshal(resp.Result, &sent); err != nil {
+		return "", fmt.Errorf("failed to decode sent message: %v", err)
+	}
+	return strconv.Itoa(sent.MessageID), nil
+}
+
+// telegramFileData возвращает файл для запроса Telegram: небольшие файлы
+// Telegram скачивает сам по ссылке, крупные загружаются ботом
+func telegramFileData(file *Attachment, kind string) (tgbotapi.RequestFileData, error) {
+	limit := telegramURLFileLimit
+	if kind == telegramPhoto {
+		limit = telegramURLPhotoLimit
+	}
+	if file.Size <= limit {
+		return tgbotapi.FileURL(file.URL), nil
+	}
+
+	resp, err := http.Get(file.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %v", file.Name, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to download %s: %s", file.Name, resp.Status)
+	}
+	if resp.ContentLength > telegramUploadLimit {
+		resp.Body.Close()
+		return nil, fmt.Errorf("file %s is too large for Telegram: %d bytes", file.Name, resp.ContentLength)
+	}
+	return tgbotapi.FileReader{Name: file.Name, Reader: resp.Body}, nil
+}
+
+// applySendOptions переносит параметры отправки в запрос Telegram. tgbotapi
+// не поддерживает message_thread_id, поэтому сообщение без ответа попадает
+// в тему форума как ответ на её первое сообщение: его ID совпадает с ID темы
+func applySendOptions(chat *tgbotapi.BaseChat, opts SendOptions) {
+	replyTo := opts.ReplyTo
+	if replyTo == "" {
+		replyTo = opts.ThreadID
+	}
+	if replyTo != "" {
+		if replyID, err := strconv.Atoi(replyTo); err == nil {
+			chat.ReplyToMessageID = replyID
+			// Если исходное сообщение уже удалено, отправляем без ответа
+			chat.AllowSendingWithoutReply = true
+		}
+	}
+}
+
+// EditText редактирование текста сообщения в чате Telegram. Текст должен быть в формате MarkdownV2
+func (t *TelegramPlatform) EditText(chatID, messageID, text string) error {
+	id, msgID, err := parseMessageRef(chatID, messageID)
+	if err != nil {
+		return err
+	}
+
+	edit := tgbotapi.NewEditMessageText(id, msgID, text)
+	edit.ParseMode = "MarkdownV2"
+	_, err = t.bot.Request(edit)
+	return err
+}
+
+// EditCaption редактирование подписи вложения в чате Telegram
+func (t *TelegramPlatform) EditCaption(chatID, messageID, caption string) error {
+	id, msgID, err := parseMessageRef(chatID, messageID)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.bot.Request(tgbotapi.NewEditMessageCaption(id, msgID, caption))
+	return err
+}
+
+// DeleteMessage удаление сообщения из чата Telegram
+func (t *TelegramPlatform) DeleteMessage(chatID, messageID string) error {
+	id, msgID, err := parseMessageRef(chatID, messageID)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.bot.Request(tgbotapi.NewDeleteMessage(id, msgID))
+	return err
+}
+
+// SetReactions ставит реакцию бота на сообщение через setMessageReaction.
+// Бот может поставить только одну реакцию, поэтому выбирается первая из
+// поддерживаемых Telegram. Пустой список снимает реакцию
+func (t *TelegramPlatform) SetReactions(chatID, messageID string, emojis []string) error {
+	id, msgID, err := parseMessageRef(chatID, messageID)
+	if err != nil {
+		return err
+	}
+
+	reaction := []telegramReaction{}
+	for _, emoji := range emojis {
+		if telegramReactionEmojis[emoji] {
+			reaction = append(reaction, telegramReaction{Type: "emoji", Emoji: emoji})
+			break
+		}
+	}
+
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", id)
+	params.AddNonZero("message_id", msgID)
+	if err := params.AddInterface("reaction", reaction); err != nil {
+		return err
+	}
+	_, err = t.bot.MakeRequest("setMessageReaction", params)
+	return err
+}
+
+// parseMessageRef преобразует строковые ID чата и сообщения Telegram в числа
+func parseMessageRef(chatID, messageID string) (int64, int, error) {
+	id, err := parseChatID(chatID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid chat ID %q: %v", chatID, err)
+	}
+	msgID, err := strconv.Atoi(messageID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid message ID %q: %v", messageID, err)
+	}
+	return id, msgID, nil
+}
+
+// Максимальная длина названия темы форума Telegram
+const telegramTopicNameLimit = 128
+
+// CreateThread создаёт тему в чате-форуме Telegram через createForumTopic.
+// Бот должен быть администратором с правом управления темами
+func (t *TelegramPlatform) CreateThread(chatID, name string) (string, error) {
+	id, err := parseChatID(chatID)
+	if err != nil {
+		return "", fmt.Errorf("invalid chat ID %q: %v", chatID, err)
+	}
+	runes := []rune(name)
+	if len(runes) > telegramTopicNameLimit {
+		name = string(runes[:telegramTopicNameLimit])
+	}
+
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", id)
+	params["name"] = name
+	resp, err := t.bot.MakeRequest("createForumTopic", params)
+	if err != nil {
+		return "", err
+	}
+
+	var topic telegramForumTopic
+	if err := json.Unmarshal(resp.Result, &topic); err != nil {
+		return "", fmt.Errorf("failed to decode forum topic: %v", err)
+	}
+	log.Printf("Created Telegram forum topic %d (%s) in chat %s", topic.ThreadID, name, chatID)
+	return strconv.Itoa(topic.ThreadID), nil
+}
+
+// FileURL получает прямую ссылку на файл Telegram по его ID. Ссылка
+// действует около часа, поэтому запрашивается непосредственно перед загрузкой
+func (t *TelegramPlatform) FileURL(file *Attachment) (string, error) {
+	if file.FileID == "" {
+		return file.URL, nil
+	}
+	fileURL, err := t.bot.GetFileDirectURL(file.FileID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get URL of file %s: %w", file.Name, err)
+	}
+	return fileURL, nil
+}
+
+// ResolveUser получение участника чата Telegram по ID.
+// Bot API не позволяет получить пользователя вне чата, поэтому используется getChat
+func (t *TelegramPlatform) ResolveUser(userID string) (*Sender, error) {
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID %q: %v", userID, err)
+	}
+
+	chat, err := t.bot.GetChat(tgbotapi.ChatInfoConfig{ChatConfig: tgbotapi.ChatConfig{ChatID: id}})
+	if err != nil {
+		return nil, err
+	}
+
+	name := chat.FirstName
+	if chat.LastName != "" {
+		name += " " + chat.LastName
+	}
+	return &Sender{ID: userID, Username: chat.UserName, Name: name}, nil
+}
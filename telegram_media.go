@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// addMedia переносит в нормализованное сообщение все вложения сообщения Telegram.
+// Файлы становятся вложениями, а геопозиции, контакты, опросы и кубики - встраиваемыми блоками
+func (t *TelegramPlatform) addMedia(msg *Message, m *tgbotapi.Message) {
+	stamp := time.Now().UnixNano()
+
+	switch {
+	// Фото (берём самое большое разрешение)
+	case len(m.Photo) > 0:
+		photo := m.Photo[len(m.Photo)-1]
+		t.addAttachment(msg, photo.FileID, fmt.Sprintf("photo_%d.jpg", stamp), "image/jpeg", photo.FileSize)
+
+	// Видеосообщения
+	case m.VideoNote != nil:
+		t.addAttachment(msg, m.VideoNote.FileID, fmt.Sprintf("video_%d.mp4", stamp), "video/mp4", m.VideoNote.FileSize)
+
+	// Голосовые сообщения
+	case m.Voice != nil:
+		if voice := t.addAttachment(msg, m.Voice.FileID, fmt.Sprintf("voice_%d.ogg", stamp), "audio/ogg", m.Voice.FileSize); voice != nil {
+			voice.Voice = true
+		}
+
+	// GIF-анимации. Telegram дублирует их в поле Document, поэтому проверяем раньше документов
+	case m.Animation != nil:
+		name := fileName(m.Animation.FileName, "animation", stamp)
+		t.addAttachment(msg, m.Animation.FileID, name, m.Animation.MimeType, m.Animation.FileSize)
+
+	case m.Video != nil:
+		name := fileName(m.Video.FileName, "video", stamp)
+		t.addAttachment(msg, m.Video.FileID, name, m.Video.MimeType, m.Video.FileSize)
+
+	case m.Audio != nil:
+		name := fileName(m.Audio.FileName, "audio", stamp)
+		t.addAttachment(msg, m.Audio.FileID, name, m.Audio.MimeType, m.Audio.FileSize)
+
+	case m.Document != nil:
+		name := fileName(m.Document.FileName, "document", stamp)
+		t.addAttachment(msg, m.Document.FileID, name, m.Document.MimeType, m.Document.FileSize)
+
+	case m.Sticker != nil:
+		t.addSticker(msg, m.Sticker, stamp)
+
+	case m.Venue != nil:
+		msg.Embeds = append(msg.Embeds, &Embed{
+			Title:       "📍 " + m.Venue.Title,
+			Description: m.Venue.Address,
+			URL:         mapURL(m.Venue.Location),
+		})
+
+	case m.Location != nil:
+		msg.Embeds = append(msg.Embeds, &Embed{
+			Title:       "📍 Геопозиция",
+			Description: fmt.Sprintf("%.6f, %.6f", m.Location.Latitude, m.Location.Longitude),
+			URL:         mapURL(*m.Location),
+		})
+
+	case m.Contact != nil:
+		name := strings.TrimSpace(m.Contact.FirstName + " " + m.Contact.LastName)
+		msg.Embeds = append(msg.Embeds, &Embed{
+			Title: "👤 Контакт",
+			Fields: []EmbedField{
+				{Name: "Имя", Value: name, Inline: true},
+				{Name: "Телефон", Value: m.Contact.PhoneNumber, Inline: true},
+			},
+		})
+
+	case m.Poll != nil:
+		msg.Embeds = append(msg.Embeds, pollEmbed(m.Poll))
+
+	case m.Dice != nil:
+		msg.Embeds = append(msg.Embeds, &Embed{
+			Title:       m.Dice.Emoji + " Бросок",
+			Description: fmt.Sprintf("Выпало: **%d**", m.Dice.Value),
+		})
+	}
+}
+
+// addSticker добавляет стикер как изображение. Статичные (WebP) и видеостикеры
+// (WebM) пересылаются файлом, для анимированных (TGS), которые Discord не
+// показывает, берётся превью. Если изображения нет, пересылается эмодзи стикера
+func (t *TelegramPlatform) addSticker(msg *Message, sticker *tgbotapi.Sticker, stamp int64) {
+	count := len(msg.Attachments)
+
+	switch {
+	case !sticker.IsAnimated:
+		// Расширение файла (webp или webm) определяется по ссылке
+		t.addAttachment(msg, sticker.FileID, fmt.Sprintf("sticker_%d", stamp), "", sticker.FileSize)
+	case sticker.Thumbnail != nil:
+		t.addAttachment(msg, sticker.Thumbnail.FileID, fmt.Sprintf("sticker_%d", stamp), "", sticker.Thumbnail.FileSize)
+	}
+
+	if len(msg.Attachments) == count && msg.Text == "" {
+		msg.Text = sticker.Emoji
+	}
+}
+
+// addAttachment добавляет файл к сообщению вложением. Если у имени нет
+// расширения, оно берётся из пути файла на серверах Telegram. Слишком
+// большие для скачивания файлы добавляются без проверки, мост перешлёт их описание
+func (t *TelegramPlatform) addAttachment(msg *Message, fileID, name, contentType string, size int) *Attachment {
+	if size <= telegramDownloadLimit {
+		file, err := t.bot.GetFile(tgbotapi.FileConfig{FileID: fileID})
+		if err != nil {
+			log.Printf("Failed to get file %s: %v", name, err)
+			return nil
+		}
+		if path.Ext(name) == "" {
+			name += path.Ext(file.FilePath)
+		}
+	}
+	attachment := &Attachment{
+		Name:        name,
+		FileID:      fileID,
+		ContentType: contentType,
+		Size:        size,
+	}
+	msg.Attachments = append(msg.Attachments, attachment)
+	return attachment
+}
+
+// fileName возвращает исходное имя файла или генерирует его по виду вложения
+func fileName(original, kind string, stamp int64) string {
+	if original != "" {
+		return original
+	}
+	return fmt.Sprintf("%s_%d", kind, stamp)
+}
+
+// mapURL ссылка на точку на карте
+func mapURL(location tgbotapi.Location) string {
+	return fmt.Sprintf("https://www.openstreetmap.org/?mlat=%f&mlon=%f#map=16/%f/%f",
+		location.Latitude, location.Longitude, location.Latitude, location.Longitude)
+}
+
+// pollEmbed встраиваемый блок с вопросом и вариантами ответа опроса
+func pollEmbed(poll *tgbotapi.Poll) *Embed {
+	embed := &Embed{Title: "📊 " + poll.Question}
+	for _, option := range poll.Options {
+		embed.Description += fmt.Sprintf("• %s — %d\n", option.Text, option.VoterCount)
+	}
+	embed.Footer = fmt.Sprintf("Голосов: %d", poll.TotalVoterCount)
+	if poll.IsClosed {
+		embed.Footer += " · опрос завершён"
+	}
+	return embed
+}
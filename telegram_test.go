@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestTelegramMediaKind(t *testing.T) {
+	tests := []struct {
+		name string
+		file Attachment
+		want string
+	}{
+		{"voice", Attachment{Name: "voice-message.ogg", ContentType: "audio/ogg", Voice: true}, telegramVoice},
+		{"ogg audio", Attachment{Name: "song.ogg", ContentType: "audio/ogg"}, telegramAudio},
+		{"mp3", Attachment{Name: "song.mp3", ContentType: "audio/mpeg"}, telegramAudio},
+		{"gif", Attachment{Name: "cat.gif", ContentType: "image/gif"}, telegramAnimation},
+		{"photo", Attachment{Name: "cat.png", ContentType: "image/png", Size: 1 << 20}, telegramPhoto},
+		{"large photo", Attachment{Name: "cat.png", ContentType: "image/png", Size: telegramUploadPhotoLimit + 1}, telegramDocument},
+		{"video", Attachment{Name: "clip.mp4", ContentType: "video/mp4"}, telegramVideo},
+		{"document", Attachment{Name: "notes.txt", ContentType: "text/plain"}, telegramDocument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := telegramMediaKind(&tt.file); got != tt.want {
+				t.Errorf("telegramMediaKind() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
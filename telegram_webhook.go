@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Заголовок, в котором Telegram передаёт секрет вебхука
+const telegramSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// Максимальный размер тела запроса с обновлением
+const telegramUpdateMaxSize = 1 << 20
+
+// SetWebhook включает получение обновлений через вебхук по адресу url.
+// Telegram будет передавать secret в заголовке каждого запроса
+func (t *TelegramPlatform) SetWebhook(url, secret string) error {
+	params := tgbotapi.Params{}
+	params["url"] = url
+	params.AddNonEmpty("secret_token", secret)
+	// Обновления передаются по одному, чтобы правки не обгоняли сами сообщения
+	params.AddNonZero("max_connections", 1)
+	if err := params.AddInterface("allowed_updates", telegramAllowedUpdates); err != nil {
+		return err
+	}
+
+	_, err := t.bot.MakeRequest("setWebhook", params)
+	return err
+}
+
+// DeleteWebhook отключает вебхук, после чего обновления снова можно получать через long polling
+func (t *TelegramPlatform) DeleteWebhook() error {
+	_, err := t.bot.MakeRequest("deleteWebhook", tgbotapi.Params{})
+	return err
+}
+
+// WebhookHandler принимает обновления от Telegram и обрабатывает их так же,
+// как при long polling. Запросы без правильного секрета отклоняются
+func (t *TelegramPlatform) WebhookHandler(secret string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(telegramSecretHeader)), []byte(secret)) != 1 {
+			log.Printf("Rejected Telegram webhook request from %s: invalid secret token", r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		var update telegramUpdate
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, telegramUpdateMaxSize)).Decode(&update); err != nil {
+			log.Printf("Failed to decode Telegram webhook update: %v", err)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		t.handleUpdate(update)
+		w.WriteHeader(http.StatusOK)
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Структура для связи ветки Discord с темой форума Telegram в пределах маршрута
+type ThreadLink struct {
+	DiscordChannelID string `json:"discord_channel_id"`
+	TelegramChatID   string `json:"telegram_chat_id"`
+	DiscordThreadID  string `json:"discord_thread_id"`
+	TelegramTopicID  string `json:"telegram_topic_id"`
+}
+
+// Структура для списка связанных веток и тем
+type Threads struct {
+	mu         sync.Mutex
+	links      []*ThreadLink
+	isModified bool // Флаг, который указывает на изменения
+}
+
+// Создание пустого списка связанных веток
+func NewThreads() *Threads {
+	return &Threads{}
+}
+
+// TelegramTopic ищет тему чата Telegram, связанную с веткой канала Discord.
+// Возвращает пустую строку, если связи нет
+func (t *Threads) TelegramTopic(discordChannelID, telegramChatID, discordThreadID string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, link := range t.links {
+		if link.DiscordChannelID == discordChannelID && link.TelegramChatID == telegramChatID && link.DiscordThreadID == discordThreadID {
+			return link.TelegramTopicID
+		}
+	}
+	return ""
+}
+
+// DiscordThread ищет ветку канала Discord, связанную с темой чата Telegram.
+// Возвращает пустую строку, если связи нет
+func (t *Threads) DiscordThread(discordChannelID, telegramChatID, telegramTopicID string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, link := range t.links {
+		if link.DiscordChannelID == discordChannelID && link.TelegramChatID == telegramChatID && link.TelegramTopicID == telegramTopicID {
+			return link.DiscordThreadID
+		}
+	}
+	return ""
+}
+
+// Add сохраняет связь ветки с темой
+func (t *Threads) Add(link *ThreadLink) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.links = append(t.links, link)
+	t.isModified = true
+}
+
+// Сохранение связанных веток в файл
+func (t *Threads) SaveToFile(filepath string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Если изменений не было, не сохраняем файл
+	if !t.isModified {
+		return nil
+	}
+
+	file, err := os.Create(filepath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+	defer file.Close()
+
+	if err := json.NewEncoder(file).Encode(t.links); err != nil {
+		return fmt.Errorf("failed to encode threads: %v", err)
+	}
+
+	t.isModified = false
+	return nil
+}
+
+// Загрузка связанных веток из файла
+func (t *Threads) LoadFromFile(filepath string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	file, err := os.Open(filepath)
+	if err != nil {
+		// Если файл не существует, не считаем это ошибкой
+		if os.IsNotExist(err) {
+			log.Printf("File %s does not exist. Starting with no linked threads.", filepath)
+			return nil
+		}
+		return fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&t.links); err != nil {
+		return fmt.Errorf("failed to decode threads: %v", err)
+	}
+
+	log.Printf("Loaded %d linked threads from %s", len(t.links), filepath)
+	return nil
+}
+
+// Функция для периодического сохранения связанных веток
+func (t *Threads) PeriodicSave(filepath string) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := t.SaveToFile(filepath); err != nil {
+			log.Printf("Failed to save threads to file: %v", err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Частота, в которой считается позиция в потоке Ogg/Opus
+const opusSampleRate = 48000
+
+// Максимальное число значений формы волны голосового сообщения Discord
+const voiceWaveformLength = 256
+
+// Ошибка разбора файла, который не является потоком Ogg/Opus
+var ErrNotOggOpus = errors.New("not an Ogg/Opus stream")
+
+// oggVoiceInfo возвращает длительность голосового сообщения Ogg/Opus в
+// секундах и форму его волны. Декодировать звук без сторонних библиотек
+// нельзя, поэтому громкость оценивается по размеру пакетов Opus: тишина
+// кодируется меньшим числом байт, чем речь
+func oggVoiceInfo(data []byte) (float64, []byte, error) {
+	packets, granule, err := oggPackets(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	// Первые два пакета - заголовки OpusHead и OpusTags, звук идёт после них
+	if len(packets) < 3 || len(packets[0]) < 19 || !bytes.HasPrefix(packets[0], []byte("OpusHead")) {
+		return 0, nil, ErrNotOggOpus
+	}
+	preSkip := int64(binary.LittleEndian.Uint16(packets[0][10:12]))
+	audio := packets[2:]
+
+	duration := float64(granule-preSkip) / opusSampleRate
+	if duration < 0 {
+		duration = 0
+	}
+
+	// Средний размер пакетов на каждом участке, растянутый на диапазон 0-255
+	count := len(audio)
+	if count > voiceWaveformLength {
+		count = voiceWaveformLength
+	}
+	levels := make([]float64, count)
+	low, high := 0.0, 0.0
+	for i := range levels {
+		from, to := i*len(audio)/count, (i+1)*len(audio)/count
+		sum := 0
+		for _, packet := range audio[from:to] {
+			sum += len(packet)
+		}
+		levels[i] = float64(sum) / float64(to-from)
+		if i == 0 || levels[i] < low {
+			low = levels[i]
+		}
+		if i == 0 || levels[i] > high {
+			high = levels[i]
+		}
+	}
+
+	waveform := make([]byte, count)
+	if high > low {
+		for i, level := range levels {
+			waveform[i] = byte((level - low) / (high - low) * 255)
+		}
+	}
+	return duration, waveform, nil
+}
+
+// oggPackets разбирает страницы Ogg и возвращает пакеты потока вместе с
+// позицией последней страницы. Пакет может продолжаться на следующей странице
+func oggPackets(data []byte) ([][]byte, int64, error) {
+	var packets [][]byte
+	var current []byte
+	var granule int64
+	for pos := 0; pos < len(data); {
+		if len(data)-pos < 27 || string(data[pos:pos+4]) != "OggS" {
+			return nil, 0, fmt.Errorf("%w: invalid page at offset %d", ErrNotOggOpus, pos)
+		}
+		// Позиция -1 означает, что на странице не заканчивается ни один пакет
+		if position := int64(binary.LittleEndian.Uint64(data[pos+6 : pos+14])); position >= 0 {
+			granule = position
+		}
+
+		segments := int(data[pos+26])
+		offset := pos + 27 + segments
+		if offset > len(data) {
+			return nil, 0, fmt.Errorf("%w: truncated page at offset %d", ErrNotOggOpus, pos)
+		}
+		for _, size := range data[pos+27 : offset] {
+			end := offset + int(size)
+			if end > len(data) {
+				return nil, 0, fmt.Errorf("%w: truncated page at offset %d", ErrNotOggOpus, pos)
+			}
+			current = append(current, data[offset:end]...)
+			offset = end
+			// Сегмент короче 255 байт завершает пакет
+			if size < 255 {
+				packets = append(packets, current)
+				current = nil
+			}
+		}
+		pos = offset
+	}
+	return packets, granule, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// oggPage собирает страницу Ogg из сегментов. Пакеты, которые не должны
+// заканчиваться на этой странице, передаются с open = true
+func oggPage(granule int64, packets [][]byte, open bool) []byte {
+	var lacing, body []byte
+	for i, packet := range packets {
+		size := len(packet)
+		for ; size >= 255; size -= 255 {
+			lacing = append(lacing, 255)
+		}
+		if !open || i < len(packets)-1 {
+			lacing = append(lacing, byte(size))
+		}
+		body = append(body, packet...)
+	}
+
+	page := make([]byte, 27, 27+len(lacing)+len(body))
+	copy(page, "OggS")
+	binary.LittleEndian.PutUint64(page[6:14], uint64(granule))
+	page[26] = byte(len(lacing))
+	page = append(page, lacing...)
+	return append(page, body...)
+}
+
+// opusStream собирает поток Ogg/Opus из заголовков и пакетов звука
+func opusStream(preSkip uint16, granule int64, audio [][]byte) []byte {
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	binary.LittleEndian.PutUint16(head[10:12], preSkip)
+
+	stream := oggPage(0, [][]byte{head}, false)
+	stream = append(stream, oggPage(0, [][]byte{[]byte("OpusTags")}, false)...)
+	// Не больше 50 пакетов на странице, чтобы не превысить 255 сегментов
+	for len(audio) > 0 {
+		n := len(audio)
+		if n > 50 {
+			n = 50
+		}
+		position := int64(-1)
+		if n == len(audio) {
+			position = granule
+		}
+		stream = append(stream, oggPage(position, audio[:n], false)...)
+		audio = audio[n:]
+	}
+	return stream
+}
+
+// packetsOfSizes пакеты заданных размеров
+func packetsOfSizes(sizes ...int) [][]byte {
+	result := make([][]byte, len(sizes))
+	for i, size := range sizes {
+		result[i] = bytes.Repeat([]byte{1}, size)
+	}
+	return result
+}
+
+func TestOggVoiceInfo(t *testing.T) {
+	many := make([]int, 600)
+	for i := range many {
+		many[i] = 20 + i%2*40
+	}
+	tests := []struct {
+		name     string
+		data     []byte
+		duration float64
+		waveform []byte
+	}{
+		{"levels", opusStream(312, 312+5*opusSampleRate, packetsOfSizes(10, 100, 10, 100)), 5, []byte{0, 255, 0, 255}},
+		{"silence", opusStream(0, opusSampleRate/2, packetsOfSizes(3, 3, 3)), 0.5, []byte{0, 0, 0}},
+		{"long", opusStream(0, 12*opusSampleRate, packetsOfSizes(many...)), 12, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			duration, waveform, err := oggVoiceInfo(tt.data)
+			if err != nil {
+				t.Fatalf("oggVoiceInfo() error: %v", err)
+			}
+			if duration != tt.duration {
+				t.Errorf("duration = %v, want %v", duration, tt.duration)
+			}
+			if tt.waveform != nil && !bytes.Equal(waveform, tt.waveform) {
+				t.Errorf("waveform = %v, want %v", waveform, tt.waveform)
+			}
+			if tt.waveform == nil && len(waveform) != voiceWaveformLength {
+				t.Errorf("waveform has %d values, want %d", len(waveform), voiceWaveformLength)
+			}
+		})
+	}
+}
+
+func TestOggVoiceInfoErrors(t *testing.T) {
+	valid := opusStream(0, opusSampleRate, packetsOfSizes(10, 20))
+	vorbis := oggPage(0, [][]byte{[]byte("\x01vorbis header bytes")}, false)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"garbage", []byte("RIFF....WAVEfmt ")},
+		{"truncated", valid[:len(valid)-5]},
+		{"not opus", append(vorbis, oggPage(0, packetsOfSizes(10, 10), false)...)},
+		{"headers only", opusStream(0, 0, nil)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := oggVoiceInfo(tt.data); !errors.Is(err, ErrNotOggOpus) {
+				t.Errorf("oggVoiceInfo() error = %v, want %v", err, ErrNotOggOpus)
+			}
+		})
+	}
+}
+
+func TestOggPacketsAcrossPages(t *testing.T) {
+	long := bytes.Repeat([]byte{7}, 300)
+	data := oggPage(-1, [][]byte{[]byte("a"), long[:255]}, true)
+	data = append(data, oggPage(960, [][]byte{long[255:], []byte("b")}, false)...)
+
+	got, granule, err := oggPackets(data)
+	if err != nil {
+		t.Fatalf("oggPackets() error: %v", err)
+	}
+	want := [][]byte{[]byte("a"), long, []byte("b")}
+	if len(got) != len(want) {
+		t.Fatalf("got %d packets, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Errorf("packet %d has %d bytes, want %d", i, len(got[i]), len(want[i]))
+		}
+	}
+	if granule != 960 {
+		t.Errorf("granule = %d, want 960", granule)
+	}
+}